@@ -1,26 +1,62 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/MrWong99/summairpg/pkg/config"
+	"github.com/MrWong99/summairpg/pkg/run"
 	"github.com/MrWong99/summairpg/pkg/summarize"
 	"github.com/MrWong99/summairpg/pkg/transcribe"
 )
 
 func main() {
 	cfg := initConfig()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// restore the default behavior so a second Ctrl+C terminates immediately
+		stop()
+	}()
 
-	lines := evaluateTranscript(cfg)
+	if cfg.Cache.Prune {
+		pruneCache(cfg)
+		return
+	}
+
+	summarizer := initSummarizer(ctx, cfg)
+	for _, format := range cfg.Audio.TranscriptOutput {
+		if !slices.Contains(transcribe.Formats, format) {
+			slog.Error("unknown transcript output format", "format", format, "formats", transcribe.Formats)
+			os.Exit(1)
+		}
+	}
+	if !slices.Contains(transcribe.LineModes, cfg.Audio.Lines.Mode) {
+		slog.Error("unknown line mode", "mode", cfg.Audio.Lines.Mode, "modes", transcribe.LineModes)
+		os.Exit(1)
+	}
+
+	r := initRun(cfg)
+	lines := evaluateTranscript(ctx, cfg, r)
+	exportTranscript(cfg, lines)
 
-	if !cfg.Ollama.Enabled && !cfg.OpenAI.Enabled {
+	if summarizer == nil {
 		slog.Info("no summary requested")
 		return
 	}
 
-	evaluateSummary(cfg, lines)
+	evaluateSummary(ctx, cfg, summarizer, r, lines)
 }
 
 func initConfig() *config.App {
@@ -33,7 +69,65 @@ func initConfig() *config.App {
 	return cfg
 }
 
-func evaluateTranscript(cfg *config.App) []transcribe.Line {
+// initRun creates a new run or opens the run that should be resumed.
+func initRun(cfg *config.App) *run.Run {
+	runsDir := filepath.Join(cfg.Output.Dir, "runs")
+	if cfg.Resume != "" {
+		r, err := run.Open(runsDir, cfg.Resume)
+		if err != nil {
+			slog.Error("could not open run to resume", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("resuming run", "run", r.Name(), "dir", r.Dir)
+		return r
+	}
+	r, err := run.New(runsDir)
+	if err != nil {
+		slog.Error("could not create run directory", "dir", runsDir, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("intermediate results are stored in run directory, use --resume to continue the run if it fails", "run", r.Name(), "dir", r.Dir)
+	return r
+}
+
+// initSummarizer creates the configured summarizer before the transcription starts so configuration errors are reported early.
+// Returns nil if no summary is requested.
+func initSummarizer(ctx context.Context, cfg *config.App) summarize.Summarizer {
+	backend := cfg.SummaryBackend()
+	if backend == config.NoSummary {
+		return nil
+	}
+	summarizer, err := summarize.New(ctx, backend, cfg)
+	if err != nil {
+		slog.Error("could not initialize summary backend", "backend", backend, "error", err)
+		os.Exit(1)
+	}
+	return summarizer
+}
+
+func evaluateTranscript(ctx context.Context, cfg *config.App, r *run.Run) []transcribe.Line {
+	if lines, err := r.Lines(); err == nil {
+		slog.Info("transcript of run will be used", "run", r.Name(), "lines", len(lines))
+		return lines
+	} else if !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("could not read transcript of run, transcribing again", "run", r.Name(), "error", err)
+	}
+	lines := transcribeLines(ctx, cfg, r)
+	if err := r.SaveLines(lines); err != nil {
+		slog.Warn("could not store transcript in run", "run", r.Name(), "error", err)
+	}
+	if cfg.Audio.DisplayTranscript {
+		fmt.Println("")
+		for _, line := range lines {
+			fmt.Println(line.String())
+		}
+		fmt.Println("")
+	}
+	return lines
+}
+
+// transcribeLines reads the configured transcript file or transcribes all audio tracks.
+func transcribeLines(ctx context.Context, cfg *config.App, r *run.Run) []transcribe.Line {
 	if cfg.Audio.TranscriptFile != "" {
 		slog.Info("transcript will be read via input file", "file", cfg.Audio.TranscriptFile)
 		lines, err := transcribe.LinesFromFile(cfg.Audio.TranscriptFile)
@@ -45,54 +139,389 @@ func evaluateTranscript(cfg *config.App) []transcribe.Line {
 		return lines
 	}
 
-	slog.Info("starting transcription now", "audio-dir", cfg.Audio.Dir, "file-types", cfg.Audio.FileTypes, "language", cfg.Audio.Language, "model", cfg.Audio.Model)
-	words, err := transcribe.AsWords(cfg.Audio.Dir, cfg.Audio.Language, cfg.Audio.Model, cfg.Audio.FileTypes)
+	transcriber, err := newTranscriber(cfg, r)
 	if err != nil {
-		slog.Error("error during transcription", "error", err)
+		slog.Error("could not initialize transcription engine", "error", err)
 		os.Exit(1)
 	}
-	lines := transcribe.ToLines(words)
+	nicknameRules, err := transcribe.NewNicknameRules(cfg.Audio.Nickname.Strip, cfg.Audio.Nickname.Aliases)
+	if err != nil {
+		slog.Error("invalid nickname rules", "error", err)
+		os.Exit(1)
+	}
+	trackFilter, err := transcribe.NewTrackFilter(cfg.Audio.Include, cfg.Audio.Exclude)
+	if err != nil {
+		slog.Error("invalid track filter", "error", err)
+		os.Exit(1)
+	}
+	offsets := make(map[string]float64, len(cfg.Audio.Offsets))
+	for track, offset := range cfg.Audio.Offsets {
+		if offsets[track], err = transcribe.ParseOffset(offset); err != nil {
+			slog.Error("invalid track offset", "track", track, "error", err)
+			os.Exit(1)
+		}
+	}
+	dirs, nicknames, cleanup := prepareAudioDirs(cfg)
+	defer cleanup()
+	slog.Info("starting transcription now", "audio-dirs", dirs, "file-types", cfg.AudioFileTypes(), "language", cfg.Audio.Language, "model", cfg.Audio.Model, "engine", cfg.Audio.Engine, "concurrency", cfg.Audio.Concurrency)
+	words, err := transcribe.AsWordsOfParts(ctx, transcriber, dirs, transcribe.Options{
+		FileTypes:        cfg.AudioFileTypes(),
+		Concurrency:      cfg.Audio.Concurrency,
+		Nicknames:        nicknames,
+		Filter:           trackFilter,
+		Languages:        cfg.Audio.Languages,
+		Offsets:          offsets,
+		DetectOffsets:    cfg.Audio.DetectOffsets,
+		DetectWindow:     cfg.Audio.DetectOffsetsWindow,
+		Timeout:          cfg.Audio.Timeout,
+		SkipSilent:       cfg.Audio.Silence.Skip,
+		SilenceThreshold: cfg.Audio.Silence.Threshold,
+		RealtimeFactor:   cfg.Audio.RealtimeFactor,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			slog.Error("transcription was canceled", "error", err, "resume", "--resume "+r.Name())
+			os.Exit(1)
+		}
+		if len(words) == 0 {
+			slog.Error("error during transcription", "error", err, "resume", "--resume "+r.Name())
+			os.Exit(1)
+		}
+		slog.Warn("some audio tracks could not be transcribed and will be missing in the transcript", "error", err)
+	}
+	if cfg.Audio.Cleanup.Enabled {
+		words = cleanupWords(cfg, words)
+	}
+	if len(cfg.Audio.Glossary) > 0 {
+		var replacements int
+		words, replacements = transcribe.ApplyGlossary(words, cfg.Audio.Glossary, cfg.Audio.GlossaryThreshold)
+		slog.Info("misheard words corrected by glossary", "replacements", replacements)
+	}
+	if cfg.Audio.Diarize.Enabled {
+		nameSpeakers(cfg, words)
+	}
+	nicknameRules.Apply(words)
+	lines := transcribe.ToLines(words, transcribe.LineOptions{
+		Mode:                 cfg.Audio.Lines.Mode,
+		Gap:                  cfg.Audio.Lines.Gap,
+		MaxWords:             cfg.Audio.Lines.MaxWords,
+		MergeOverlaps:        cfg.Audio.Lines.MergeOverlaps,
+		TakeoverPause:        cfg.Audio.Lines.TakeoverPause,
+		Annotate:             cfg.Audio.Lines.Annotate,
+		MaxInterjectionWords: cfg.Audio.Lines.MaxInterjectionWords,
+	})
 	slog.Info("transcription finished", "words", len(words), "lines", len(lines))
+	return lines
+}
 
-	if cfg.Audio.DisplayTranscript {
-		fmt.Println("")
-		for _, line := range lines {
-			fmt.Println(line.String())
+// cleanupWords removes low confidence words, loops and hallucinations and logs what was removed.
+func cleanupWords(cfg *config.App, words []transcribe.Word) []transcribe.Word {
+	cleaned, report := transcribe.Cleanup(words, transcribe.CleanupOptions{
+		MinScore:        cfg.Audio.Cleanup.MinScore,
+		MaxRepeats:      cfg.Audio.Cleanup.MaxRepeats,
+		MaxPhraseLength: cfg.Audio.Cleanup.MaxPhraseLength,
+		Hallucinations:  append(slices.Clone(transcribe.DefaultHallucinations), cfg.Audio.Cleanup.Hallucinations...),
+	})
+	for _, removal := range report.Removals {
+		if removal.Reason == transcribe.ReasonLowScore {
+			continue
 		}
-		fmt.Println("")
+		line := transcribe.Line{Nickname: removal.Words[0].Nickname, Words: removal.Words}
+		slog.Info("removed words from transcript", "reason", removal.Reason, "start", removal.Words[0].StartTime, "text", line.String())
 	}
-	return lines
+	slog.Info("transcript cleaned up", "removed-words", len(words)-len(cleaned),
+		transcribe.ReasonLowScore, report.Count(transcribe.ReasonLowScore),
+		transcribe.ReasonHallucination, report.Count(transcribe.ReasonHallucination),
+		transcribe.ReasonRepetition, report.Count(transcribe.ReasonRepetition))
+	return cleaned
 }
 
-func evaluateSummary(cfg *config.App, lines []transcribe.Line) {
-	var summary string
-	var err error
-	switch {
-	case cfg.Ollama.Enabled:
-		oc := summarize.NewOllamaClient(cfg.Ollama.Address, cfg.Ollama.Model)
-		if cfg.Ollama.ContextLengthOverride > 0 {
-			oc.ContextLength = cfg.Ollama.ContextLengthOverride
+// exportTranscript writes the transcript in all requested formats to the output directory.
+func exportTranscript(cfg *config.App, lines []transcribe.Line) {
+	for _, format := range cfg.Audio.TranscriptOutput {
+		file, err := transcribe.ExportFile(cfg.Output.Dir, format, lines)
+		if err != nil {
+			slog.Error("could not write transcript", "format", format, "error", err)
+			continue
+		}
+		slog.Info("transcript written", "file", file)
+	}
+}
+
+// prepareAudioDirs returns the directories of all parts of the session together with the nicknames of the tracks.
+// The audio dir can be a comma-separated list of directories or Craig archives, one for each part of the session.
+// A directory without audio files whose subdirectories contain the parts is supported as well (see transcribe.SessionParts).
+// Craig archives are extracted into a temporary directory that is removed by calling cleanup.
+func prepareAudioDirs(cfg *config.App) (dirs []string, nicknames map[string]string, cleanup func()) {
+	sources := []string{cfg.Audio.Archive}
+	if cfg.Audio.Archive == "" {
+		sources = strings.Split(cfg.Audio.Dir, ",")
+	}
+	nicknames = make(map[string]string)
+	workDir := ""
+	cleanup = func() {
+		if workDir == "" {
+			return
 		}
-		if cfg.Ollama.UpdateModel {
-			slog.Info("updating Ollama model", "model", cfg.Ollama.Model)
-			if err := oc.UpdateModel(); err != nil {
-				slog.Error("update failed", "error", err)
+		if err := os.RemoveAll(workDir); err != nil {
+			slog.Warn("could not remove work directory", "dir", workDir, "error", err)
+		}
+	}
+	for i, source := range sources {
+		source = strings.TrimSpace(source)
+		if !strings.EqualFold(filepath.Ext(source), ".zip") {
+			parts, err := transcribe.SessionParts(source, cfg.AudioFileTypes())
+			if err != nil {
+				cleanup()
+				slog.Error("could not read audio dir", "error", err)
 				os.Exit(1)
 			}
+			dirs = append(dirs, parts...)
+			continue
+		}
+		if workDir == "" {
+			var err error
+			if workDir, err = os.MkdirTemp("", "summairpg-craig-*"); err != nil {
+				slog.Error("could not create work directory for Craig archive", "error", err)
+				os.Exit(1)
+			}
+		}
+		slog.Info("extracting Craig archive", "archive", source, "work-dir", workDir)
+		rec, err := transcribe.ExtractCraigArchive(source, filepath.Join(workDir, fmt.Sprintf("part%d", i+1)))
+		if err != nil {
+			cleanup()
+			slog.Error("could not extract Craig archive", "error", err)
+			os.Exit(1)
+		}
+		for stem, name := range rosterNicknames(cfg, rec.Usernames) {
+			nicknames[stem] = name
+		}
+		dirs = append(dirs, rec.Dir)
+	}
+	return dirs, nicknames, cleanup
+}
+
+// rosterNicknames maps the Discord usernames of all tracks to the character names of the roster.
+// Unknown usernames are added to the roster with an empty character name so they can easily be filled in the config file.
+func rosterNicknames(cfg *config.App, usernames map[string]string) map[string]string {
+	nicknames := make(map[string]string, len(usernames))
+	added := false
+	for stem, username := range usernames {
+		name, ok := cfg.Audio.Roster[username]
+		if !ok {
+			cfg.Audio.Roster[username] = ""
+			added = true
+		}
+		if name == "" {
+			slog.Warn("Discord user has no character name in the roster, using the username instead", "user", username)
+			name = username
+		}
+		nicknames[stem] = name
+	}
+	if added && cfg.Config.Store {
+		if err := config.UpdateStored(cfg); err != nil {
+			slog.Warn("could not store roster in config file", "file", config.ConfigFile, "error", err)
+		}
+	}
+	return nicknames
+}
+
+func newTranscriber(cfg *config.App, r *run.Run) (transcribe.Transcriber, error) {
+	var engine interface {
+		transcribe.Transcriber
+		transcribe.Fingerprinter
+	}
+	switch cfg.Audio.Engine {
+	case transcribe.EngineWhisperX:
+		engine = &transcribe.WhisperX{
+			Model:         cfg.Audio.Model,
+			Language:      cfg.Audio.Language,
+			Diarize:       cfg.Audio.Diarize.Enabled,
+			HfToken:       os.Getenv("HF_TOKEN"),
+			MinSpeakers:   cfg.Audio.Diarize.MinSpeakers,
+			MaxSpeakers:   cfg.Audio.Diarize.MaxSpeakers,
+			InitialPrompt: transcribe.GlossaryPrompt(cfg.Audio.Glossary),
+			AlignModel:    cfg.Audio.WhisperX.AlignModel,
+			BatchSize:     cfg.Audio.WhisperX.BatchSize,
+			Device:        cfg.Audio.WhisperX.Device,
+			ComputeType:   cfg.Audio.WhisperX.ComputeType,
+			VadOnset:      cfg.Audio.WhisperX.VadOnset,
+			VadOffset:     cfg.Audio.WhisperX.VadOffset,
+			ExtraArgs:     cfg.Audio.WhisperX.ExtraArgs,
+			Wrapper:       strings.Fields(cfg.Audio.WhisperX.Wrapper),
+			Progress:      logProgress(),
+		}
+	case transcribe.EngineWhisperCpp:
+		if cfg.Audio.Diarize.Enabled {
+			return nil, fmt.Errorf("diarization is not supported by the %s engine", transcribe.EngineWhisperCpp)
+		}
+		engine = &transcribe.WhisperCpp{
+			Binary:        cfg.Audio.WhisperCpp.Binary,
+			Model:         cfg.Audio.Model,
+			ModelsDir:     cfg.Audio.WhisperCpp.ModelsDir,
+			Language:      cfg.Audio.Language,
+			InitialPrompt: transcribe.GlossaryPrompt(cfg.Audio.Glossary),
+			Progress:      logProgress(),
+		}
+	default:
+		return nil, fmt.Errorf("unknown audio engine %q, must be one of %s or %s", cfg.Audio.Engine, transcribe.EngineWhisperX, transcribe.EngineWhisperCpp)
+	}
+	if cfg.Audio.Chunk.MaxLength > 0 {
+		if cfg.Audio.Diarize.Enabled {
+			slog.Warn("the speaker labels of the diarization may differ between the chunks of an audio track", "chunk-max-length", cfg.Audio.Chunk.MaxLength)
+		}
+		engine = &transcribe.ChunkedTranscriber{
+			Transcriber: engine,
+			Options: transcribe.ChunkOptions{
+				MaxLength:   cfg.Audio.Chunk.MaxLength,
+				Dir:         r.Dir,
+				Concurrency: cfg.Audio.Chunk.Concurrency,
+			},
+		}
+	}
+	if cfg.Audio.Preprocess.Enabled {
+		cacheDir, err := cacheDir(cfg)
+		if err != nil {
+			return nil, err
+		}
+		engine = &transcribe.PreprocessedTranscriber{
+			Transcriber: engine,
+			Options: transcribe.PreprocessOptions{
+				Dir:      filepath.Join(cacheDir, transcribe.AudioCacheDir),
+				Loudnorm: cfg.Audio.Preprocess.Loudnorm,
+				Denoise:  cfg.Audio.Preprocess.Denoise,
+			},
+		}
+	}
+	if cfg.Cache.Enabled {
+		cacheDir, err := cacheDir(cfg)
+		if err != nil {
+			return nil, err
+		}
+		engine = &transcribe.CachedTranscriber{
+			Transcriber: engine,
+			Dir:         cacheDir,
+			Refresh:     cfg.Cache.Refresh,
+		}
+	}
+	return r.Transcriber(engine), nil
+}
+
+// logProgress returns a ProgressFunc that logs the progress of each audio file in steps of 10 percent.
+func logProgress() transcribe.ProgressFunc {
+	var mu sync.Mutex
+	reported := make(map[string]int)
+	return func(file transcribe.AudioFile, percent float64) {
+		step := int(percent) / 10 * 10
+		mu.Lock()
+		defer mu.Unlock()
+		if last, ok := reported[file.Filename]; ok && last == step {
+			return
+		}
+		reported[file.Filename] = step
+		slog.Info("transcription progress", "file", file.Filename, "percent", step)
+	}
+}
+
+// nameSpeakers replaces the speaker labels of the diarization with the configured character names.
+// If requested all unknown speakers will be prompted for on the console and the names are stored in the config.
+func nameSpeakers(cfg *config.App, words []transcribe.Word) {
+	if cfg.Audio.Diarize.Prompt && promptSpeakerNames(words, cfg.Audio.Diarize.Speakers) && cfg.Config.Store {
+		if err := config.UpdateStored(cfg); err != nil {
+			slog.Warn("could not store speaker names in config file", "file", config.ConfigFile, "error", err)
+		}
+	}
+	transcribe.RenameSpeakers(words, cfg.Audio.Diarize.Speakers)
+}
+
+// promptSpeakerNames asks on the console for the character names of all speakers that are not in the speakers map yet.
+// Returns true if any new name was added to the map.
+func promptSpeakerNames(words []transcribe.Word, speakers map[string]string) bool {
+	const maxSampleWords = 40
+	changed := false
+	in := bufio.NewReader(os.Stdin)
+	for _, sample := range transcribe.SpeakerSamples(words) {
+		if _, ok := speakers[sample.Nickname]; ok {
+			continue
+		}
+		if len(sample.Words) > maxSampleWords {
+			sample.Words = sample.Words[:maxSampleWords]
+		}
+		fmt.Printf("\n%s\nCharacter name for %s (leave empty to keep the label): ", sample.String(), sample.Nickname)
+		name, err := in.ReadString('\n')
+		name = strings.TrimSpace(name)
+		if name != "" {
+			speakers[sample.Nickname] = name
+			changed = true
+		}
+		if err != nil {
+			slog.Warn("could not read speaker name from console", "error", err)
+			break
 		}
-		slog.Info("starting summary now", "model", cfg.Ollama.Model, "address", cfg.Ollama.Address)
-		summary, err = oc.Summarize(lines)
-	case cfg.OpenAI.Enabled:
-		slog.Info("starting summary now", "model", cfg.OpenAI.Model, "url", cfg.OpenAI.Url)
-		oc := summarize.NewOpenAIClient(cfg.OpenAI.Url, cfg.OpenAI.Model, cfg.OpenAI.OrgId, cfg.OpenAI.ApiType, cfg.OpenAI.ApiVersion)
-		summary, err = oc.Summarize(lines)
 	}
+	fmt.Println("")
+	return changed
+}
 
+func cacheDir(cfg *config.App) (string, error) {
+	if cfg.Cache.Dir != "" {
+		return cfg.Cache.Dir, nil
+	}
+	dir, err := transcribe.DefaultCacheDir()
 	if err != nil {
-		slog.Error("error during summarization", "error", err)
+		return "", fmt.Errorf("could not determine cache directory, please provide one via cache-dir: %w", err)
+	}
+	return dir, nil
+}
+
+func pruneCache(cfg *config.App) {
+	dir, err := cacheDir(cfg)
+	if err != nil {
+		slog.Error("could not prune cache", "error", err)
+		os.Exit(1)
+	}
+	removed, err := transcribe.PruneCache(dir, cfg.Cache.MaxAge)
+	if err != nil {
+		slog.Error("could not prune cache", "dir", dir, "error", err)
 		os.Exit(1)
 	}
-	slog.Info("summary finished")
+	slog.Info("cache pruned", "dir", dir, "removed", removed, "max-age", cfg.Cache.MaxAge)
+}
+
+func evaluateSummary(ctx context.Context, cfg *config.App, summarizer summarize.Summarizer, r *run.Run, lines []transcribe.Line) {
+	summary, err := r.Summary()
+	if err == nil {
+		slog.Info("summary of run will be used, delete it to summarize again", "run", r.Name(), "file", r.SummaryFile())
+	} else {
+		// imported transcripts might not contain a language, the AI then answers in the language of the transcript
+		language := transcribe.DominantLanguage(lines)
+		slog.Info("starting summary now", "language", language)
+		summary, err = summarizer.Summarize(ctx, lines, summarize.Options{Checkpoint: r, Language: language})
+		if err != nil {
+			slog.Error("error during summarization", "error", err, "resume", "--resume "+r.Name())
+			os.Exit(1)
+		}
+		slog.Info("summary finished")
+		if err := r.SaveSummary(summary); err != nil {
+			slog.Warn("could not store summary in run", "run", r.Name(), "error", err)
+		}
+	}
+	if err := writeSummary(cfg.Output.Dir, summary); err != nil {
+		slog.Warn("could not write summary file", "dir", cfg.Output.Dir, "error", err)
+	}
 	fmt.Println("")
 	fmt.Println(summary)
 }
+
+// writeSummary writes the summary to dir/summary.md.
+func writeSummary(dir, summary string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, "summary.md")
+	if err := os.WriteFile(file, []byte(summary+"\n"), 0644); err != nil {
+		return err
+	}
+	slog.Info("summary written", "file", file)
+	return nil
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/itzg/go-flagsfiller"
 	"github.com/sashabaranov/go-openai"
@@ -23,10 +25,18 @@ type App struct {
 	Config Config `json:"-"`
 	// Audio are just the settings for the input audio files.
 	Audio Audio `json:"audio"`
+	// Output settings for the created files.
+	Output Output `json:"output"`
+	// Cache settings for the transcription results.
+	Cache Cache `json:"cache"`
+	// Summary settings that apply to all summary backends.
+	Summary Summary `json:"summary"`
 	// Ollama settings for summarizing the transcriptions.
 	Ollama Ollama `json:"ollama"`
 	// OpenAI settings for summarizing the transcriptions.
 	OpenAI OpenAI `json:"openai" env:"openai"`
+	// Resume is the name or directory of a previous run that should be continued.
+	Resume string `json:"-" default:"" usage:"the name or directory of a previous run in <output-dir>/runs that should be continued from its last completed stage"`
 }
 
 type Config struct {
@@ -39,15 +49,204 @@ type Audio struct {
 	// TranscriptFile will be used as the audio transcript if set. This will skip the execution of WhisperX entirely.
 	TranscriptFile string `json:"transcript-file" default:"" usage:"when set the entire transcription will be skipped and this files content will be used as summarization input"`
 	// Dir is the directory that contains all of the audio files that should be transcribed.
-	Dir string `json:"dir" default:"input" usage:"The directory that contains all of the audio files that should be transcribed"`
-	// Language that the spoken chat is in.
-	Language string `json:"language" default:"en" usage:"The spoken language in the audio files"`
+	// Multiple directories or Craig archives of a session recorded in parts are separated by commas.
+	Dir string `json:"dir" default:"input" usage:"The directory that contains all of the audio files that should be transcribed. Can also be a Craig multitrack ZIP archive. Sessions recorded in multiple parts can be given as comma-separated list or as a directory with one subdirectory per part"`
+	// Archive is a Craig multitrack ZIP archive that will be extracted and used instead of Dir.
+	Archive string `json:"archive" default:"" usage:"a Craig multitrack ZIP archive that will be extracted and transcribed instead of audio-dir"`
+	// Roster maps Discord usernames of Craig recordings to character names.
+	Roster map[string]string `json:"roster" default:"" usage:"maps the Discord usernames of Craig recordings to character names, e.g. myuser=Darell,gmuser=GameMaster"`
+	// Language that the spoken chat is in or auto to detect it.
+	Language string `json:"language" default:"en" usage:"The spoken language in the audio files or auto to detect the language of each audio file"`
+	// Languages maps the file name (without extension) or nickname of tracks to their spoken language.
+	Languages map[string]string `json:"languages" default:"" usage:"maps the file name (without extension) or nickname of tracks to their spoken language if it differs from audio-language, e.g. GameMaster=de,Darell=auto"`
 	// FileTypes are the file extensions that should be considered when looking up audio tracks. They should be a comma-separated list.
-	FileTypes []string `json:"file-types" default:"flac,wav" usage:"the file extensions that should be considered when looking up audio tracks. They should be a comma-separated list"`
+	FileTypes []string `json:"file-types" default:"flac,wav" override-value:"true" usage:"the file extensions that should be considered when looking up audio tracks. They should be a comma-separated list"`
+	// Include are patterns of the names of tracks that should be transcribed. If empty all tracks are transcribed.
+	Include []string `json:"include" default:"" override-value:"true" usage:"patterns of the names of tracks that should be transcribed, all other tracks are ignored. Glob patterns like 1-* or regular expressions enclosed in slashes like /^\\d+-/ are matched against the file name and the nickname of each track. They should be a comma-separated list, so regular expressions must not contain commas"`
+	// Exclude are patterns of the names of tracks that should not be transcribed, e.g. of music or dice bots.
+	Exclude []string `json:"exclude" default:"" override-value:"true" usage:"patterns of the names of tracks that should not be transcribed, e.g. *bot*,raw to ignore bots and the mixdown track. Glob patterns or regular expressions enclosed in slashes are matched against the file name and the nickname of each track. They should be a comma-separated list, so regular expressions must not contain commas"`
 	// Model to use. See https://ollama.com/library
 	Model string `json:"model" default:"large-v3" usage:"WhisperX model to use. See https://huggingface.co/models?sort=trending&search=whisper"`
 	// DisplayTranscript can be true to print the entire transcription to console.
 	DisplayTranscript bool `json:"display-transcript" default:"false" usage:"can be set to true to print the entire transcription to console"`
+	// TranscriptOutput are the formats the transcript should be written in. They should be a comma-separated list.
+	TranscriptOutput []string `json:"transcript-output" default:"" override-value:"true" usage:"the formats the transcript should be written to the output-dir in. Can be any of txt, srt, vtt, json and md. They should be a comma-separated list"`
+	// Engine is the speech-to-text engine to use. Must be one of whisperx or whisper.cpp.
+	Engine string `json:"engine" default:"whisperx" usage:"the speech-to-text engine to use. Must be one of whisperx or whisper.cpp"`
+	// Concurrency is the maximum amount of audio tracks that are transcribed in parallel.
+	Concurrency int `json:"concurrency" default:"1" usage:"the maximum amount of audio tracks that are transcribed in parallel"`
+	// WhisperX settings that are only used when Engine is whisperx.
+	WhisperX WhisperX `json:"whisperx"`
+	// WhisperCpp settings that are only used when Engine is whisper.cpp.
+	WhisperCpp WhisperCpp `json:"whisper-cpp"`
+	// Diarize settings to identify multiple speakers in one audio file.
+	Diarize Diarize `json:"diarize"`
+	// Nickname rules to merge multiple tracks of the same speaker.
+	Nickname Nickname `json:"nickname"`
+	// Cleanup settings to remove unreliable words and hallucinations after the transcription.
+	Cleanup Cleanup `json:"cleanup"`
+	// Preprocess settings to convert the audio files before the transcription.
+	Preprocess Preprocess `json:"preprocess"`
+	// Chunk settings to split long audio tracks.
+	Chunk Chunk `json:"chunk"`
+	// Silence settings to skip audio tracks without speech.
+	Silence Silence `json:"silence"`
+	// Lines settings to split the transcript into lines.
+	Lines Lines `json:"lines"`
+	// Glossary are proper nouns of the campaign like names of characters and places that the transcription engine should recognize.
+	Glossary []string `json:"glossary" default:"" override-value:"true" usage:"proper nouns of the campaign like names of characters and places, e.g. Xanathar,Waterdeep. They are passed to the transcription engine as initial prompt and misheard words are corrected to them. They should be a comma-separated list"`
+	// GlossaryThreshold is the minimum similarity (0 to 1) of misheard words to a glossary term to be corrected.
+	GlossaryThreshold float64 `json:"glossary-threshold" default:"0.8" usage:"the minimum similarity (0 to 1) of misheard words to a term of audio-glossary to be replaced by it. 0 disables the correction"`
+	// Offsets maps the file name (without extension) or nickname of tracks to the time their recording started relative to the session.
+	Offsets map[string]string `json:"offsets" default:"" usage:"maps the file name (without extension) or nickname of tracks to the time their recording started relative to the session, e.g. Darell=1m30s,GameMaster=0.5"`
+	// DetectOffsets can be true to automatically detect the offsets of all tracks without a configured offset.
+	DetectOffsets bool `json:"detect-offsets" default:"false" usage:"set to true to detect the offsets of all tracks by a shared audio cue (e.g. a clap) at the beginning of the recording. Requires ffmpeg"`
+	// DetectOffsetsWindow is the length of the beginning of each track that is used to detect the offsets.
+	DetectOffsetsWindow time.Duration `json:"detect-offsets-window" default:"1m" usage:"the length of the beginning of each track that must contain the shared audio cue when detecting offsets"`
+	// Timeout is the maximum duration of the transcription of a single audio track. 0 means no timeout.
+	Timeout time.Duration `json:"timeout" default:"0s" usage:"the maximum duration of the transcription of a single audio track. 0 means no timeout"`
+	// RealtimeFactor is how many times faster than realtime the transcription engine is expected to be. 0 disables the estimate.
+	RealtimeFactor float64 `json:"realtime-factor" default:"10" usage:"how many times faster than realtime the transcription engine is expected to be, used to estimate the runtime of WAV and FLAC tracks up front. 0 disables the estimate"`
+}
+
+// Chunk settings to split long audio tracks at silences, so the transcription engine does not run out of memory.
+type Chunk struct {
+	// MaxLength of a chunk. 0 disables the splitting.
+	MaxLength time.Duration `json:"max-length" default:"0s" usage:"the maximum length of the chunks that WAV and FLAC tracks are split into at silences before the transcription, e.g. 30m. 0 disables the splitting"`
+	// Concurrency is the maximum amount of chunks of one audio track that are transcribed in parallel.
+	Concurrency int `json:"concurrency" default:"1" usage:"the maximum amount of chunks of one audio track that are transcribed in parallel"`
+}
+
+// Silence settings to skip audio tracks without speech, e.g. of players that were muted all session.
+type Silence struct {
+	// Skip can be true to skip all silent WAV and FLAC tracks.
+	Skip bool `json:"skip" default:"true" usage:"set to false to transcribe WAV and FLAC tracks even if they are silent"`
+	// Threshold is the RMS level in dBFS that a track must exceed to not be silent.
+	Threshold float64 `json:"threshold" default:"-60" usage:"the RMS level in dBFS that half a second of a track must exceed for the track to not be silent"`
+}
+
+// Preprocess settings to convert the audio files to 16 kHz mono WAV files via ffmpeg before the transcription.
+type Preprocess struct {
+	// Enabled if the audio files should be converted.
+	Enabled bool `json:"enabled" default:"false" usage:"set to true to convert all audio files to 16 kHz mono WAV files before the transcription. Requires ffmpeg"`
+	// Loudnorm can be true to normalize the loudness of the audio files.
+	Loudnorm bool `json:"loudnorm" default:"false" usage:"set to true to normalize the loudness of the audio files when preprocessing, which helps with quiet microphones"`
+	// Denoise can be true to remove background noise from the audio files.
+	Denoise bool `json:"denoise" default:"false" usage:"set to true to remove background noise like fans or hissing microphones when preprocessing"`
+	// FileTypes are the file extensions that are considered in addition to Audio.FileTypes if the audio files are converted.
+	FileTypes []string `json:"file-types" default:"ogg,opus,m4a,aac,mp3" override-value:"true" usage:"the file extensions that are considered in addition to audio-file-types when looking up audio tracks if audio-preprocess-enabled is set. They should be a comma-separated list"`
+}
+
+// Lines settings to split the transcript into lines.
+type Lines struct {
+	// Mode is either gap or sentence.
+	Mode string `json:"mode" default:"gap" usage:"how lines of one speaker are split. Must be one of gap (only after a pause of audio-lines-gap) or sentence (also at the end of every sentence or segment)"`
+	// Gap is the minimum time between the starts of two consecutive words of a speaker that starts a new line.
+	Gap time.Duration `json:"gap" default:"5s" usage:"the minimum time between the starts of two consecutive words of a speaker that starts a new line"`
+	// MaxWords is the maximum amount of words of a line. 0 means no maximum.
+	MaxWords int `json:"max-words" default:"0" usage:"the maximum amount of words of a line. Longer lines are split after the last complete sentence. 0 means no maximum"`
+	// MergeOverlaps can be true to keep the line of a speaker contiguous when other speakers talk at the same time.
+	MergeOverlaps bool `json:"merge-overlaps" default:"false" usage:"set to true to keep the line of a speaker together when other speakers talk at the same time. Otherwise the line is split whenever another speaker talks"`
+	// TakeoverPause is the minimum pause of a speaker in which another speaker must talk to start a new line when merging overlaps.
+	TakeoverPause time.Duration `json:"takeover-pause" default:"1s" usage:"the minimum pause of a speaker in which another speaker must talk to start a new line when audio-lines-merge-overlaps is set. Shorter remarks of others follow the line"`
+	// Annotate can be true to mark interruptions and interjections in the transcript.
+	Annotate bool `json:"annotate" default:"false" usage:"set to true to mark lines that interrupt another speaker with [interrupts <nickname>] and short remarks with [interjection]. Requires audio-lines-merge-overlaps"`
+	// MaxInterjectionWords is the maximum amount of words of an interjection.
+	MaxInterjectionWords int `json:"max-interjection-words" default:"3" usage:"the maximum amount of words of a line spoken during another line to be marked as interjection instead of interruption"`
+}
+
+// Cleanup settings to remove unreliable words and hallucinations after the transcription.
+type Cleanup struct {
+	// Enabled if the transcription should be cleaned up.
+	Enabled bool `json:"enabled" default:"true" usage:"set to false to keep low confidence words, repeated loops and known hallucinations in the transcript"`
+	// MinScore is the minimum confidence score of a word between 0 and 1.
+	MinScore float64 `json:"min-score" default:"0" usage:"the minimum confidence score (0 to 1) of a word. Words with a lower score are removed"`
+	// MaxRepeats is the maximum amount of direct repetitions of a phrase before it is considered a loop.
+	MaxRepeats int `json:"max-repeats" default:"4" usage:"the maximum amount of direct repetitions of a phrase before it is considered a hallucinated loop. 0 disables the loop detection"`
+	// MaxPhraseLength is the maximum amount of words of a repeated phrase.
+	MaxPhraseLength int `json:"max-phrase-length" default:"8" usage:"the maximum amount of words of a phrase that is checked for repeated loops"`
+	// Hallucinations are additional phrases that are removed when spoken on their own.
+	Hallucinations []string `json:"hallucinations" default:"" override-value:"true" usage:"additional phrases that are removed when they are spoken on their own, e.g. 'Thank you for watching'. They should be a comma-separated list"`
+}
+
+// Nickname rules to merge multiple tracks of the same speaker. They are applied after all other name mappings.
+type Nickname struct {
+	// Strip are regular expressions whose matches are removed from all nicknames.
+	Strip []string `json:"strip" default:"" override-value:"true" usage:"regular expressions whose matches are removed from all nicknames, e.g. -\\d+$ to merge the tracks 1-myuser-0 and 1-myuser-1. They should be a comma-separated list"`
+	// Aliases maps nicknames to the nickname that should be used instead.
+	Aliases map[string]string `json:"aliases" default:"" usage:"maps nicknames to the nickname that should be used instead, e.g. Darell2=Darell"`
+}
+
+// Diarize settings to identify multiple speakers in one audio file, e.g. when recording a table with a single microphone.
+// Diarization requires the environment variable HF_TOKEN to contain a Hugging Face access token.
+type Diarize struct {
+	// Enabled if WhisperX should identify the speakers.
+	Enabled bool `json:"enabled" default:"false" usage:"set to true to let WhisperX identify multiple speakers in each audio file. Requires the environment variable HF_TOKEN"`
+	// MinSpeakers is the minimum amount of speakers. 0 lets WhisperX decide.
+	MinSpeakers int `json:"min-speakers" default:"0" usage:"the minimum amount of speakers when diarizing. 0 lets WhisperX decide"`
+	// MaxSpeakers is the maximum amount of speakers. 0 lets WhisperX decide.
+	MaxSpeakers int `json:"max-speakers" default:"0" usage:"the maximum amount of speakers when diarizing. 0 lets WhisperX decide"`
+	// Speakers maps the speaker labels like SPEAKER_00 to character names.
+	Speakers map[string]string `json:"speakers" default:"" usage:"maps the speaker labels to character names, e.g. SPEAKER_00=GameMaster,SPEAKER_01=Darell"`
+	// Prompt can be true to interactively ask for the names of all speakers that are not in Speakers.
+	Prompt bool `json:"prompt" default:"false" usage:"set to true to interactively ask for the character names of all speakers that are not mapped in audio-diarize-speakers"`
+}
+
+// WhisperX settings that are only used when the whisperx engine is selected.
+type WhisperX struct {
+	// Wrapper is a command that WhisperX is run with, e.g. conda run -n whisperx.
+	Wrapper string `json:"wrapper" aliases:"audio-whisperx-wrapper" default:"" usage:"a command to run whisperx with, e.g. 'conda run -n whisperx'"`
+	// AlignModel is the phoneme model used to align the word timestamps. If empty a default for the language is used.
+	AlignModel string `json:"align-model" aliases:"audio-whisperx-align-model" default:"" usage:"the phoneme model used to align the word timestamps. If empty a default for audio-language is used"`
+	// BatchSize is the amount of segments that are transcribed in parallel.
+	BatchSize int `json:"batch-size" aliases:"audio-whisperx-batch-size" default:"4" usage:"the amount of segments that whisperx transcribes in parallel. Lower it if the GPU runs out of memory"`
+	// Device to run the models on, e.g. cuda or cpu. If empty WhisperX decides.
+	Device string `json:"device" aliases:"audio-whisperx-device" default:"" usage:"the device to run whisperx on, e.g. cuda or cpu. If empty whisperx decides"`
+	// ComputeType of the model, e.g. float16 or int8. If empty WhisperX decides.
+	ComputeType string `json:"compute-type" aliases:"audio-whisperx-compute-type" default:"" usage:"the compute type of the whisperx model, e.g. float16, float32 or int8. If empty whisperx decides"`
+	// VadOnset is the threshold to detect the start of speech. 0 lets WhisperX decide.
+	VadOnset float64 `json:"vad-onset" aliases:"audio-whisperx-vad-onset" default:"0" usage:"the threshold (0 to 1) of the voice activity detection to start a speech segment. 0 lets whisperx decide"`
+	// VadOffset is the threshold to detect the end of speech. 0 lets WhisperX decide.
+	VadOffset float64 `json:"vad-offset" aliases:"audio-whisperx-vad-offset" default:"0" usage:"the threshold (0 to 1) of the voice activity detection to end a speech segment. 0 lets whisperx decide"`
+	// ExtraArgs are additional arguments that are passed to WhisperX as-is.
+	ExtraArgs []string `json:"extra-args" aliases:"audio-whisperx-extra-args" default:"" override-value:"true" usage:"additional arguments that are passed to whisperx as-is, e.g. --beam_size,10. They should be a comma-separated list"`
+}
+
+// WhisperCpp settings that are only used when the whisper.cpp engine is selected.
+type WhisperCpp struct {
+	// Binary is the name or path of the whisper.cpp CLI.
+	Binary string `json:"binary" default:"whisper-cli" usage:"the name or path of the whisper.cpp CLI"`
+	// ModelsDir is the directory containing the ggml-<model>.bin files.
+	ModelsDir string `json:"models-dir" default:"models" usage:"the directory containing the whisper.cpp ggml-<audio-model>.bin files. Not required if audio-model is a path to a model file"`
+}
+
+// Output settings for the created files.
+type Output struct {
+	// Dir is the directory where the summary and transcripts are written to.
+	Dir string `json:"dir" default:"output" usage:"the directory where the summary and transcripts are written to"`
+}
+
+// Cache settings for the transcription results.
+type Cache struct {
+	// Enabled if transcription results should be cached.
+	Enabled bool `json:"enabled" default:"true" usage:"set to false to disable caching of the transcription results"`
+	// Dir is the cache directory. If empty the summairpg directory inside the users cache directory is used.
+	Dir string `json:"dir" default:"" usage:"the cache directory. If empty the summairpg directory inside the users cache directory is used"`
+	// Refresh will transcribe all audio files again and overwrite the cached results.
+	Refresh bool `json:"-" default:"false" usage:"set to true to transcribe all audio files again and overwrite the cached results"`
+	// Prune removes all cache entries not used for longer than MaxAge and exits afterwards.
+	Prune bool `json:"-" default:"false" usage:"set to true to remove all cache entries that have not been used for longer than cache-max-age and exit"`
+	// MaxAge is the time after which unused cache entries are removed when pruning the cache.
+	MaxAge time.Duration `json:"max-age" default:"720h" usage:"the time after which unused cache entries are removed when pruning the cache. 0 removes all entries"`
+}
+
+// NoSummary is the summary backend that disables the summarization.
+const NoSummary = "none"
+
+// Summary settings that apply to all summary backends.
+type Summary struct {
+	// Backend is the name of the summary backend to use. If empty the backend is chosen by the enabled flag of Ollama or OpenAI.
+	Backend string `json:"backend" default:"" usage:"the name of the summary backend to use, e.g. ollama, openai or none. If empty the backend is chosen by ollama-enabled or openai-enabled"`
 }
 
 // Ollama settings for summarizing the transcriptions.
@@ -78,6 +277,8 @@ type OpenAI struct {
 	ApiType openai.APIType `json:"api-type" aliases:"openai-api-type" default:"OPEN_AI" usage:"the type of OpenAI endpoint. Must be one of OPEN_AI, AZURE or AZURE_AD"`
 	// ApiVersion to use. Only required if ApiType is AZURE or AZURE_AD.
 	ApiVersion string `json:"api-version" aliases:"openai-api-version" default:"" usage:"the version of the Azure API to use. Not required when openai-api-type is OPEN_AI"`
+	// ContextLength is the maximum amount of tokens sent in one request. Longer transcripts will be summarized in chunks.
+	ContextLength int `json:"context-length" aliases:"openai-context-length" default:"32000" usage:"the maximum amount of tokens sent in one request. Longer transcripts will be summarized in chunks"`
 }
 
 // Init returns the App config that uses both flags and the config file as input. Flags will override configurations provided in the summairpg-config.json.
@@ -88,18 +289,13 @@ func Init() (*App, error) {
 	if err := flagFiller.Fill(flag.CommandLine, &config); err != nil {
 		return nil, fmt.Errorf("could not prepare command-line flags: %w", err)
 	}
-	if err := overrideDefaultsFromConfig(); err != nil {
+	if err := overrideDefaultsFromConfig(config); err != nil {
 		return nil, fmt.Errorf("could not read config file %q: %w", ConfigFile, err)
 	}
 	flag.Parse()
-	if config.Ollama.Enabled && config.OpenAI.Enabled {
+	if config.Summary.Backend == "" && config.Ollama.Enabled && config.OpenAI.Enabled {
 		return &config, errors.New("you must not enable both Ollama and OpenAI")
 	}
-	if config.OpenAI.Enabled {
-		if _, ok := os.LookupEnv("OPENAI_API_KEY"); !ok {
-			return &config, errors.New("when using the OpenAI API you must set the environment variable OPENAI_API_KEY")
-		}
-	}
 	if !config.Config.Store {
 		return &config, nil
 	}
@@ -109,6 +305,36 @@ func Init() (*App, error) {
 	return &config, nil
 }
 
+// AudioFileTypes returns the file extensions that should be considered when looking up audio tracks.
+// These are the Audio.FileTypes together with the Preprocess.FileTypes if preprocessing is enabled.
+func (a *App) AudioFileTypes() []string {
+	if !a.Audio.Preprocess.Enabled {
+		return a.Audio.FileTypes
+	}
+	fileTypes := slices.Clone(a.Audio.FileTypes)
+	for _, fileType := range a.Audio.Preprocess.FileTypes {
+		if !slices.Contains(fileTypes, fileType) {
+			fileTypes = append(fileTypes, fileType)
+		}
+	}
+	return fileTypes
+}
+
+// SummaryBackend returns the name of the summary backend to use.
+// If Summary.Backend is not set it will be determined by the enabled flags of Ollama and OpenAI.
+func (a *App) SummaryBackend() string {
+	switch {
+	case a.Summary.Backend != "":
+		return a.Summary.Backend
+	case a.Ollama.Enabled:
+		return "ollama"
+	case a.OpenAI.Enabled:
+		return "openai"
+	default:
+		return NoSummary
+	}
+}
+
 // UpdateStored App config in the summairpg-config.json file with 0644 permissions.
 // The file will be truncated if it already exists.
 func UpdateStored(config *App) error {
@@ -122,7 +348,9 @@ func UpdateStored(config *App) error {
 	return enc.Encode(config)
 }
 
-func overrideDefaultsFromConfig() error {
+// overrideDefaultsFromConfig sets the defaults of all flags to the values of the ConfigFile.
+// Settings that are missing in the file (e.g. because they were added in a newer version) keep the given defaults.
+func overrideDefaultsFromConfig(defaults App) error {
 	cfgFile, err := os.Open(ConfigFile)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -132,7 +360,7 @@ func overrideDefaultsFromConfig() error {
 	}
 	defer cfgFile.Close()
 
-	var config App
+	config := defaults
 	if err = json.NewDecoder(cfgFile).Decode(&config); err != nil {
 		return err
 	}
@@ -142,14 +370,128 @@ func overrideDefaultsFromConfig() error {
 			f.Value.Set(config.Audio.TranscriptFile)
 		case "audio-dir":
 			f.Value.Set(config.Audio.Dir)
+		case "audio-archive":
+			f.Value.Set(config.Audio.Archive)
+		case "audio-roster":
+			f.Value.Set(joinMap(config.Audio.Roster))
 		case "audio-language":
 			f.Value.Set(config.Audio.Language)
+		case "audio-languages":
+			f.Value.Set(joinMap(config.Audio.Languages))
 		case "audio-file-types":
 			f.Value.Set(strings.Join(config.Audio.FileTypes, ","))
+		case "audio-include":
+			f.Value.Set(strings.Join(config.Audio.Include, ","))
+		case "audio-exclude":
+			f.Value.Set(strings.Join(config.Audio.Exclude, ","))
 		case "audio-model":
 			f.Value.Set(config.Audio.Model)
 		case "audio-display-transcript":
 			f.Value.Set(strconv.FormatBool(config.Audio.DisplayTranscript))
+		case "audio-transcript-output":
+			f.Value.Set(strings.Join(config.Audio.TranscriptOutput, ","))
+		case "output-dir":
+			f.Value.Set(config.Output.Dir)
+		case "audio-engine":
+			f.Value.Set(config.Audio.Engine)
+		case "audio-concurrency":
+			f.Value.Set(strconv.Itoa(config.Audio.Concurrency))
+		case "audio-diarize-enabled":
+			f.Value.Set(strconv.FormatBool(config.Audio.Diarize.Enabled))
+		case "audio-diarize-min-speakers":
+			f.Value.Set(strconv.Itoa(config.Audio.Diarize.MinSpeakers))
+		case "audio-diarize-max-speakers":
+			f.Value.Set(strconv.Itoa(config.Audio.Diarize.MaxSpeakers))
+		case "audio-diarize-speakers":
+			f.Value.Set(joinMap(config.Audio.Diarize.Speakers))
+		case "audio-diarize-prompt":
+			f.Value.Set(strconv.FormatBool(config.Audio.Diarize.Prompt))
+		case "audio-nickname-strip":
+			f.Value.Set(strings.Join(config.Audio.Nickname.Strip, ","))
+		case "audio-nickname-aliases":
+			f.Value.Set(joinMap(config.Audio.Nickname.Aliases))
+		case "audio-cleanup-enabled":
+			f.Value.Set(strconv.FormatBool(config.Audio.Cleanup.Enabled))
+		case "audio-cleanup-min-score":
+			f.Value.Set(strconv.FormatFloat(config.Audio.Cleanup.MinScore, 'f', -1, 64))
+		case "audio-cleanup-max-repeats":
+			f.Value.Set(strconv.Itoa(config.Audio.Cleanup.MaxRepeats))
+		case "audio-cleanup-max-phrase-length":
+			f.Value.Set(strconv.Itoa(config.Audio.Cleanup.MaxPhraseLength))
+		case "audio-cleanup-hallucinations":
+			f.Value.Set(strings.Join(config.Audio.Cleanup.Hallucinations, ","))
+		case "audio-preprocess-enabled":
+			f.Value.Set(strconv.FormatBool(config.Audio.Preprocess.Enabled))
+		case "audio-preprocess-loudnorm":
+			f.Value.Set(strconv.FormatBool(config.Audio.Preprocess.Loudnorm))
+		case "audio-preprocess-denoise":
+			f.Value.Set(strconv.FormatBool(config.Audio.Preprocess.Denoise))
+		case "audio-preprocess-file-types":
+			f.Value.Set(strings.Join(config.Audio.Preprocess.FileTypes, ","))
+		case "audio-chunk-max-length":
+			f.Value.Set(config.Audio.Chunk.MaxLength.String())
+		case "audio-chunk-concurrency":
+			f.Value.Set(strconv.Itoa(config.Audio.Chunk.Concurrency))
+		case "audio-silence-skip":
+			f.Value.Set(strconv.FormatBool(config.Audio.Silence.Skip))
+		case "audio-silence-threshold":
+			f.Value.Set(strconv.FormatFloat(config.Audio.Silence.Threshold, 'f', -1, 64))
+		case "audio-realtime-factor":
+			f.Value.Set(strconv.FormatFloat(config.Audio.RealtimeFactor, 'f', -1, 64))
+		case "audio-lines-mode":
+			f.Value.Set(config.Audio.Lines.Mode)
+		case "audio-lines-gap":
+			f.Value.Set(config.Audio.Lines.Gap.String())
+		case "audio-lines-max-words":
+			f.Value.Set(strconv.Itoa(config.Audio.Lines.MaxWords))
+		case "audio-lines-merge-overlaps":
+			f.Value.Set(strconv.FormatBool(config.Audio.Lines.MergeOverlaps))
+		case "audio-lines-takeover-pause":
+			f.Value.Set(config.Audio.Lines.TakeoverPause.String())
+		case "audio-lines-annotate":
+			f.Value.Set(strconv.FormatBool(config.Audio.Lines.Annotate))
+		case "audio-lines-max-interjection-words":
+			f.Value.Set(strconv.Itoa(config.Audio.Lines.MaxInterjectionWords))
+		case "audio-glossary":
+			f.Value.Set(strings.Join(config.Audio.Glossary, ","))
+		case "audio-glossary-threshold":
+			f.Value.Set(strconv.FormatFloat(config.Audio.GlossaryThreshold, 'f', -1, 64))
+		case "audio-offsets":
+			f.Value.Set(joinMap(config.Audio.Offsets))
+		case "audio-detect-offsets":
+			f.Value.Set(strconv.FormatBool(config.Audio.DetectOffsets))
+		case "audio-detect-offsets-window":
+			f.Value.Set(config.Audio.DetectOffsetsWindow.String())
+		case "audio-timeout":
+			f.Value.Set(config.Audio.Timeout.String())
+		case "audio-whisperx-wrapper":
+			f.Value.Set(config.Audio.WhisperX.Wrapper)
+		case "audio-whisperx-align-model":
+			f.Value.Set(config.Audio.WhisperX.AlignModel)
+		case "audio-whisperx-batch-size":
+			f.Value.Set(strconv.Itoa(config.Audio.WhisperX.BatchSize))
+		case "audio-whisperx-device":
+			f.Value.Set(config.Audio.WhisperX.Device)
+		case "audio-whisperx-compute-type":
+			f.Value.Set(config.Audio.WhisperX.ComputeType)
+		case "audio-whisperx-vad-onset":
+			f.Value.Set(strconv.FormatFloat(config.Audio.WhisperX.VadOnset, 'f', -1, 64))
+		case "audio-whisperx-vad-offset":
+			f.Value.Set(strconv.FormatFloat(config.Audio.WhisperX.VadOffset, 'f', -1, 64))
+		case "audio-whisperx-extra-args":
+			f.Value.Set(strings.Join(config.Audio.WhisperX.ExtraArgs, ","))
+		case "audio-whisper-cpp-binary":
+			f.Value.Set(config.Audio.WhisperCpp.Binary)
+		case "audio-whisper-cpp-models-dir":
+			f.Value.Set(config.Audio.WhisperCpp.ModelsDir)
+		case "cache-enabled":
+			f.Value.Set(strconv.FormatBool(config.Cache.Enabled))
+		case "cache-dir":
+			f.Value.Set(config.Cache.Dir)
+		case "cache-max-age":
+			f.Value.Set(config.Cache.MaxAge.String())
+		case "summary-backend":
+			f.Value.Set(config.Summary.Backend)
 		case "ollama-enabled":
 			f.Value.Set(strconv.FormatBool(config.Ollama.Enabled))
 		case "ollama-address":
@@ -172,7 +514,18 @@ func overrideDefaultsFromConfig() error {
 			f.Value.Set(string(config.OpenAI.ApiType))
 		case "openai-api-version":
 			f.Value.Set(config.OpenAI.ApiVersion)
+		case "openai-context-length":
+			f.Value.Set(strconv.Itoa(config.OpenAI.ContextLength))
 		}
 	})
 	return nil
 }
+
+// joinMap formats the map as comma-separated key=value pairs so it can be used as flag value.
+func joinMap(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
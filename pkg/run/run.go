@@ -0,0 +1,166 @@
+// Package run persists the intermediate results of one execution of summairpg,
+// so a failed or interrupted execution can be resumed from the last completed stage.
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrWong99/summairpg/pkg/transcribe"
+)
+
+const (
+	// nameLayout is the time layout of the names of new runs.
+	nameLayout = "20060102-150405"
+	// linesFile contains the merged transcript of the run in the JSON format of transcribe.Export.
+	linesFile = "transcript." + transcribe.FormatJSON
+	// checkpointFile contains the answers of the AI for the summary.
+	checkpointFile = "summary-checkpoint.json"
+	// summaryFile contains the final summary.
+	summaryFile = "summary.md"
+)
+
+// Run is a directory that holds the intermediate results of one execution:
+//   - the transcript of each audio track in the transcripts subdirectory (see Transcriber)
+//   - the merged transcript
+//   - the answers of the AI for the summary (see Load and Store)
+//   - the final summary
+type Run struct {
+	// Dir of the run.
+	Dir string
+
+	mu sync.Mutex
+}
+
+// New creates a new run directory inside of dir that is named after the current time.
+func New(dir string) (*Run, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := time.Now().Format(nameLayout)
+	runDir := filepath.Join(dir, name)
+	// multiple runs within the same second get a counter as suffix
+	for i := 2; ; i++ {
+		err := os.Mkdir(runDir, 0755)
+		if err == nil {
+			return &Run{Dir: runDir}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		runDir = filepath.Join(dir, fmt.Sprintf("%s-%d", name, i))
+	}
+}
+
+// Open an existing run. The name is either the path to the run directory or the name of a run inside of dir.
+func Open(dir, name string) (*Run, error) {
+	for _, runDir := range []string{name, filepath.Join(dir, name)} {
+		if info, err := os.Stat(runDir); err == nil && info.IsDir() {
+			return &Run{Dir: runDir}, nil
+		}
+	}
+	return nil, fmt.Errorf("run %q does not exist in %q", name, dir)
+}
+
+// Name of the run that can be used to Open it again.
+func (r *Run) Name() string {
+	return filepath.Base(r.Dir)
+}
+
+// Transcriber returns a Transcriber that stores the transcript of each audio track in the run,
+// so only the tracks that were not transcribed yet are transcribed when resuming.
+func (r *Run) Transcriber(t interface {
+	transcribe.Transcriber
+	transcribe.Fingerprinter
+}) *transcribe.CachedTranscriber {
+	return &transcribe.CachedTranscriber{
+		Transcriber: t,
+		Dir:         r.Dir,
+	}
+}
+
+// SaveLines stores the merged transcript in the run.
+func (r *Run) SaveLines(lines []transcribe.Line) error {
+	_, err := transcribe.ExportFile(r.Dir, transcribe.FormatJSON, lines)
+	return err
+}
+
+// Lines returns the merged transcript of the run. The error is os.ErrNotExist if it was not saved yet.
+func (r *Run) Lines() ([]transcribe.Line, error) {
+	filename := filepath.Join(r.Dir, linesFile)
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	return transcribe.LinesFromFile(filename)
+}
+
+// SummaryFile returns the path of the file that contains the final summary.
+func (r *Run) SummaryFile() string {
+	return filepath.Join(r.Dir, summaryFile)
+}
+
+// SaveSummary stores the final summary in the run.
+func (r *Run) SaveSummary(summary string) error {
+	return os.WriteFile(r.SummaryFile(), []byte(summary+"\n"), 0644)
+}
+
+// Summary returns the final summary of the run. The error is os.ErrNotExist if it was not saved yet.
+// The summary is not tied to the backend, model or prompt that created it, so it is returned even if they changed since.
+func (r *Run) Summary() (string, error) {
+	content, err := os.ReadFile(r.SummaryFile())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(content), "\n"), nil
+}
+
+// Load returns the stored answer of the AI for the key. Implements summarize.Checkpoint.
+func (r *Run) Load(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	answers, err := r.readCheckpoint()
+	if err != nil {
+		return "", false
+	}
+	answer, ok := answers[key]
+	return answer, ok
+}
+
+// Store the answer of the AI for the key. Implements summarize.Checkpoint.
+func (r *Run) Store(key, answer string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	answers, err := r.readCheckpoint()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if answers == nil {
+		answers = make(map[string]string)
+	}
+	answers[key] = answer
+	content, err := json.MarshalIndent(answers, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so an interruption never leaves a corrupted checkpoint
+	tmpFile := filepath.Join(r.Dir, checkpointFile+".tmp")
+	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filepath.Join(r.Dir, checkpointFile))
+}
+
+func (r *Run) readCheckpoint() (map[string]string, error) {
+	content, err := os.ReadFile(filepath.Join(r.Dir, checkpointFile))
+	if err != nil {
+		return nil, err
+	}
+	var answers map[string]string
+	return answers, json.Unmarshal(content, &answers)
+}
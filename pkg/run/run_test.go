@@ -0,0 +1,104 @@
+package run
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MrWong99/summairpg/pkg/transcribe"
+)
+
+func TestNewAndOpen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	first, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Dir == second.Dir {
+		t.Fatalf("both runs use the directory %s", first.Dir)
+	}
+
+	for _, name := range []string{first.Name(), first.Dir} {
+		r, err := Open(dir, name)
+		if err != nil {
+			t.Fatalf("could not open run by %q: %v", name, err)
+		}
+		if r.Name() != first.Name() {
+			t.Errorf("opened run %q by %q, want %q", r.Name(), name, first.Name())
+		}
+	}
+	if _, err := Open(dir, "20000101-000000"); err == nil {
+		t.Error("opened a run that does not exist")
+	}
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	r, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Lines(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got error %v for missing transcript, want os.ErrNotExist", err)
+	}
+	if _, err := r.Summary(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got error %v for missing summary, want os.ErrNotExist", err)
+	}
+	if _, ok := r.Load("chunk-1"); ok {
+		t.Error("loaded an answer from an empty checkpoint")
+	}
+
+	lines := []transcribe.Line{
+		{Nickname: "GameMaster", Words: []transcribe.Word{{Nickname: "GameMaster", Text: "Roll", StartTime: 1, EndTime: 1.3}, {Nickname: "GameMaster", Text: "initiative!", StartTime: 1.4, EndTime: 2}}},
+		{Nickname: "Darell", Words: []transcribe.Word{{Nickname: "Darell", Text: "Natural", StartTime: 3, EndTime: 3.5, Score: 0.9}, {Nickname: "Darell", Text: "20", StartTime: 3.6, EndTime: 4}}},
+	}
+	if err := r.SaveLines(lines); err != nil {
+		t.Fatal(err)
+	}
+	for key, answer := range map[string]string{"chunk-1": "The party fights.", "chunk-2": "The party rests."} {
+		if err := r.Store(key, answer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Store("chunk-1", "The party fights goblins."); err != nil {
+		t.Fatal(err)
+	}
+
+	// resume the run like after a crash
+	resumed, err := Open(dir, r.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := resumed.Lines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(lines) {
+		t.Fatalf("got %d lines, want %d", len(got), len(lines))
+	}
+	for i := range got {
+		if got[i].String() != lines[i].String() || got[i].Start() != lines[i].Start() {
+			t.Errorf("line %d is %q at %v, want %q at %v", i, got[i].String(), got[i].Start(), lines[i].String(), lines[i].Start())
+		}
+	}
+	for key, want := range map[string]string{"chunk-1": "The party fights goblins.", "chunk-2": "The party rests."} {
+		if answer, ok := resumed.Load(key); !ok || answer != want {
+			t.Errorf("loaded %q, %t for %s, want %q", answer, ok, key, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(r.Dir, checkpointFile+".tmp")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary checkpoint file was left behind: %v", err)
+	}
+
+	if err := resumed.SaveSummary("# Session 1\n\nThe party fights goblins."); err != nil {
+		t.Fatal(err)
+	}
+	if summary, err := r.Summary(); err != nil || summary != "# Session 1\n\nThe party fights goblins." {
+		t.Errorf("got summary %q, %v", summary, err)
+	}
+}
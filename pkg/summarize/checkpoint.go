@@ -0,0 +1,56 @@
+package summarize
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Checkpoint persists the answers of the AI by the request they were given for,
+// so an interrupted summary can be continued without sending the same requests again.
+type Checkpoint interface {
+	// Load returns the stored answer for the key or false if there is none.
+	Load(key string) (string, bool)
+	// Store the answer for the key.
+	Store(key, answer string) error
+}
+
+// checkpointed returns a chatFunc that answers requests from the checkpoint if possible and stores all new answers in it.
+// If the checkpoint is nil chat is returned as-is.
+func checkpointed(chat chatFunc, checkpoint Checkpoint) chatFunc {
+	if checkpoint == nil {
+		return chat
+	}
+	return func(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+		key, err := checkpointKey(messages)
+		if err != nil {
+			return chat(ctx, messages)
+		}
+		if answer, ok := checkpoint.Load(key); ok {
+			slog.Info("using answer from checkpoint", "key", key)
+			return answer, nil
+		}
+		answer, err := chat(ctx, messages)
+		if err != nil {
+			return "", err
+		}
+		if err := checkpoint.Store(key, answer); err != nil {
+			slog.Warn("could not store answer in checkpoint", "key", key, "error", err)
+		}
+		return answer, nil
+	}
+}
+
+// checkpointKey is the SHA-256 hash of the messages.
+func checkpointKey(messages []openai.ChatCompletionMessage) (string, error) {
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
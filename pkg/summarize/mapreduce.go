@@ -0,0 +1,181 @@
+package summarize
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/MrWong99/summairpg/pkg/transcribe"
+	"github.com/sashabaranov/go-openai"
+)
+
+// responseTokenReserve is the amount of tokens that are left spare in every request so the AI can answer.
+const responseTokenReserve = 500
+
+//go:embed summary_reduce_prompt.txt
+var reduceSystemPrompt string
+
+// chatFunc sends the messages to the AI and returns its answer.
+type chatFunc func(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error)
+
+// mapReduce summarizes the lines by splitting them into chunks that fit into the contextLength.
+// Each chunk is summarized on its own and all partial summaries are then merged into one final summary.
+func mapReduce(ctx context.Context, chat chatFunc, lines []transcribe.Line, contextLength int, opts Options) (string, error) {
+	if len(lines) == 0 {
+		return "", errors.New("the transcript does not contain any lines to summarize")
+	}
+	chat = checkpointed(chat, opts.Checkpoint)
+	systemPrompt := opts.systemPrompt()
+	budget := contextLength - responseTokenReserve - NumTokensFromMessages(chatMessages(systemPrompt, ""))
+	if budget <= 0 {
+		return "", fmt.Errorf("context length %d is too small to fit the system prompt", contextLength)
+	}
+	chunks := chunkLines(lines, budget)
+	if len(chunks) > 1 {
+		slog.Info("transcript is too long for the context length and will be summarized in chunks", "chunks", len(chunks), "context-length", contextLength)
+	}
+	partials := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if len(chunks) > 1 {
+			slog.Info("summarizing chunk", "chunk", i+1, "chunks", len(chunks), "lines", len(chunk))
+		}
+		summary, err := chat(ctx, chatMessages(systemPrompt, joinLines(chunk)))
+		if err != nil {
+			return "", fmt.Errorf("could not summarize chunk %d of %d: %w", i+1, len(chunks), err)
+		}
+		partials[i] = summary
+	}
+	return reduce(ctx, chat, partials, contextLength, opts)
+}
+
+// reduce merges the partial summaries until only one summary is left.
+// If the partial summaries don't fit into the context length at once they will be merged in multiple rounds.
+func reduce(ctx context.Context, chat chatFunc, partials []string, contextLength int, opts Options) (string, error) {
+	reducePrompt := opts.reducePrompt()
+	budget := contextLength - responseTokenReserve - NumTokensFromMessages(chatMessages(reducePrompt, ""))
+	for round := 1; len(partials) > 1; round++ {
+		groups := groupPartials(partials, budget)
+		slog.Info("merging partial summaries", "round", round, "partials", len(partials), "requests", len(groups))
+		merged := make([]string, len(groups))
+		for i, group := range groups {
+			summary, err := chat(ctx, chatMessages(reducePrompt, joinPartials(group)))
+			if err != nil {
+				return "", fmt.Errorf("could not merge partial summaries in round %d: %w", round, err)
+			}
+			merged[i] = summary
+		}
+		partials = merged
+	}
+	return partials[0], nil
+}
+
+// chunkLines splits the lines into consecutive chunks that each contain at most maxTokens tokens.
+// Lines will never be cut in half unless a single line is bigger than maxTokens.
+func chunkLines(lines []transcribe.Line, maxTokens int) [][]transcribe.Line {
+	chunks := make([][]transcribe.Line, 0)
+	current := make([]transcribe.Line, 0)
+	currentTokens := 0
+	for _, line := range lines {
+		for _, part := range splitLine(line, maxTokens) {
+			tokens := numTokens(part.String()) + 1 // +1 for the line break
+			if currentTokens+tokens > maxTokens && len(current) > 0 {
+				chunks = append(chunks, current)
+				current = make([]transcribe.Line, 0)
+				currentTokens = 0
+			}
+			current = append(current, part)
+			currentTokens += tokens
+		}
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// splitLine splits a single line into multiple lines of the same speaker if it contains more than maxTokens tokens.
+func splitLine(line transcribe.Line, maxTokens int) []transcribe.Line {
+	if numTokens(line.String())+1 <= maxTokens {
+		return []transcribe.Line{line}
+	}
+	parts := make([]transcribe.Line, 0)
+	part := transcribe.Line{Nickname: line.Nickname}
+	prefixTokens := numTokens(line.Nickname + ": ")
+	partTokens := prefixTokens
+	for _, word := range line.Words {
+		tokens := numTokens(" " + word.Text)
+		if partTokens+tokens+1 > maxTokens && len(part.Words) > 0 {
+			parts = append(parts, part)
+			part = transcribe.Line{Nickname: line.Nickname}
+			partTokens = prefixTokens
+		}
+		part.Words = append(part.Words, word)
+		partTokens += tokens
+	}
+	if len(part.Words) > 0 {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// groupPartials groups consecutive partial summaries so that each group fits into maxTokens.
+// Every group contains at least two partial summaries (if available) so that each reduce round makes progress.
+func groupPartials(partials []string, maxTokens int) [][]string {
+	groups := make([][]string, 0)
+	current := make([]string, 0)
+	currentTokens := 0
+	for _, partial := range partials {
+		tokens := numTokens(partialHeader(len(current)+1)+partial) + 2
+		if currentTokens+tokens > maxTokens && len(current) > 1 {
+			groups = append(groups, current)
+			current = make([]string, 0)
+			currentTokens = 0
+			tokens = numTokens(partialHeader(1)+partial) + 2
+		}
+		current = append(current, partial)
+		currentTokens += tokens
+	}
+	if len(current) == 1 && len(groups) > 0 {
+		// a single leftover would not be reduced any further, so merge it into the last group
+		groups[len(groups)-1] = append(groups[len(groups)-1], current[0])
+	} else if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+func partialHeader(part int) string {
+	return fmt.Sprintf("Part %d:\n", part)
+}
+
+func joinPartials(partials []string) string {
+	parts := make([]string, len(partials))
+	for i, partial := range partials {
+		parts[i] = partialHeader(i+1) + strings.TrimSpace(partial)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func joinLines(lines []transcribe.Line) string {
+	lineStrings := make([]string, len(lines))
+	for i, line := range lines {
+		lineStrings[i] = line.String()
+	}
+	return strings.Join(lineStrings, "\n")
+}
+
+func chatMessages(systemPrompt, userPrompt string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		{
+			Role:    "system",
+			Content: systemPrompt,
+		},
+		{
+			Role:    "user",
+			Content: userPrompt,
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package summarize
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MrWong99/summairpg/pkg/transcribe"
+)
+
+func testLine(nickname string, words int) transcribe.Line {
+	line := transcribe.Line{Nickname: nickname}
+	for i := range words {
+		line.Words = append(line.Words, transcribe.Word{Nickname: nickname, Text: fmt.Sprintf("word%d", i), StartTime: float64(i)})
+	}
+	return line
+}
+
+// manyLines returns n rounds of a conversation of three speakers.
+func manyLines(n int) []transcribe.Line {
+	lines := make([]transcribe.Line, 0, 3*n)
+	for range n {
+		lines = append(lines, testLine("Darell", 12), testLine("GameMaster", 30), testLine("Vex", 2))
+	}
+	return lines
+}
+
+func TestChunkLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		lines      []transcribe.Line
+		maxTokens  int
+		wantChunks int
+	}{
+		{
+			name:       "fits in one chunk",
+			lines:      []transcribe.Line{testLine("Darell", 5), testLine("GameMaster", 8), testLine("Darell", 3)},
+			maxTokens:  1000,
+			wantChunks: 1,
+		},
+		{
+			name:      "single line over budget",
+			lines:     []transcribe.Line{testLine("GameMaster", 200)},
+			maxTokens: 50,
+		},
+		{
+			name:      "many lines",
+			lines:     manyLines(20),
+			maxTokens: 120,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkLines(tt.lines, tt.maxTokens)
+			if tt.wantChunks > 0 && len(chunks) != tt.wantChunks {
+				t.Errorf("got %d chunks, want %d", len(chunks), tt.wantChunks)
+			}
+			words := make([]transcribe.Word, 0)
+			for i, chunk := range chunks {
+				tokens := 0
+				for _, line := range chunk {
+					tokens += numTokens(line.String()) + 1
+					words = append(words, line.Words...)
+				}
+				if tokens > tt.maxTokens {
+					t.Errorf("chunk %d has %d tokens, want at most %d", i, tokens, tt.maxTokens)
+				}
+			}
+			wantWords := make([]transcribe.Word, 0)
+			for _, line := range tt.lines {
+				wantWords = append(wantWords, line.Words...)
+			}
+			if !slices.Equal(words, wantWords) {
+				t.Errorf("chunks contain %d words, want the %d words of the lines in order", len(words), len(wantWords))
+			}
+		})
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	line := testLine("GameMaster", 200)
+	parts := splitLine(line, 50)
+	if len(parts) < 2 {
+		t.Fatalf("got %d parts, want the line to be split", len(parts))
+	}
+	words := make([]transcribe.Word, 0)
+	for i, part := range parts {
+		if part.Nickname != line.Nickname {
+			t.Errorf("part %d has nickname %q, want %q", i, part.Nickname, line.Nickname)
+		}
+		if tokens := numTokens(part.String()) + 1; tokens > 50 {
+			t.Errorf("part %d has %d tokens, want at most 50", i, tokens)
+		}
+		words = append(words, part.Words...)
+	}
+	if !slices.Equal(words, line.Words) {
+		t.Error("parts do not contain the words of the line in order")
+	}
+
+	short := testLine("Darell", 3)
+	if parts := splitLine(short, 50); len(parts) != 1 {
+		t.Errorf("got %d parts for a short line, want 1", len(parts))
+	}
+}
+
+func TestGroupPartials(t *testing.T) {
+	partial := strings.Repeat("The party fought the beholder. ", 10)
+	tests := []struct {
+		name      string
+		partials  int
+		maxTokens int
+	}{
+		{name: "all fit", partials: 4, maxTokens: 10000},
+		{name: "two per group", partials: 5, maxTokens: 2 * (numTokens(partialHeader(1)+partial) + 2)},
+		{name: "single leftover", partials: 7, maxTokens: 3 * (numTokens(partialHeader(1)+partial) + 2)},
+		{name: "none fit", partials: 3, maxTokens: 10},
+		{name: "two partials that do not fit", partials: 2, maxTokens: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partials := make([]string, tt.partials)
+			for i := range partials {
+				partials[i] = partial
+			}
+			groups := groupPartials(partials, tt.maxTokens)
+			if len(groups) >= len(partials) {
+				t.Fatalf("got %d groups for %d partials, the reduce round would not make progress", len(groups), len(partials))
+			}
+			total := 0
+			for i, group := range groups {
+				if len(group) < 2 {
+					t.Errorf("group %d contains %d partials, want at least 2", i, len(group))
+				}
+				total += len(group)
+			}
+			if total != len(partials) {
+				t.Errorf("groups contain %d partials, want %d", total, len(partials))
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package summarize
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,10 +10,31 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/MrWong99/summairpg/pkg/config"
 	"github.com/MrWong99/summairpg/pkg/transcribe"
 	"github.com/sashabaranov/go-openai"
 )
 
+// OllamaBackend is the name under which the OllamaClient is registered.
+const OllamaBackend = "ollama"
+
+func init() {
+	Register(OllamaBackend, func(ctx context.Context, cfg *config.App) (Summarizer, error) {
+		oc := NewOllamaClient(cfg.Ollama.Address, cfg.Ollama.Model)
+		if cfg.Ollama.ContextLengthOverride > 0 {
+			oc.ContextLength = cfg.Ollama.ContextLengthOverride
+		}
+		if cfg.Ollama.UpdateModel {
+			slog.Info("updating Ollama model", "model", cfg.Ollama.Model)
+			if err := oc.UpdateModel(ctx); err != nil {
+				return nil, fmt.Errorf("could not update Ollama model %q: %w", cfg.Ollama.Model, err)
+			}
+		}
+		slog.Info("using Ollama for summarization", "model", cfg.Ollama.Model, "address", cfg.Ollama.Address)
+		return oc, nil
+	})
+}
+
 // OllamaClient to use when addressing the Ollama API.
 type OllamaClient struct {
 	// Address is the combination of host:port for the Ollama endpoint.
@@ -86,46 +108,40 @@ type OllamaChatResponse struct {
 }
 
 // Summarize the given lines of text using a special system prompt.
-func (c *OllamaClient) Summarize(lines []transcribe.Line) (string, error) {
-	// TODO: split by tokens so not to overload the AI
-	fullText := ""
-	for _, line := range lines {
-		fullText += "\n" + line.String()
-	}
-	fullText = strings.TrimPrefix(fullText, "\n")
+// If the lines don't fit into the ContextLength they will be summarized in chunks that are merged afterwards.
+func (c *OllamaClient) Summarize(ctx context.Context, lines []transcribe.Line, opts Options) (string, error) {
+	return mapReduce(ctx, c.chat, lines, c.ContextLength, opts)
+}
+
+func (c *OllamaClient) chat(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
 	chatReq := OllamaChatRequest{
 		Model: c.Model,
-		Messages: []struct {
+		Messages: make([]struct {
 			Role    string "json:\"role\""
 			Content string "json:\"content\""
-		}{
-			{
-				Role:    "system",
-				Content: summarySystemPrompt,
-			},
-			{
-				Role:    "user",
-				Content: fullText,
-			},
-		},
+		}, len(messages)),
 		Stream: false,
 		Options: map[string]any{
 			"num_ctx": c.ContextLength,
 		},
 	}
-	tokenCount := NumTokensFromMessages(chatReq.toOpenAIMessages())
-	if tokenCount > c.ContextLength-500 { // leave some tokens spare so AI can answer
+	for i, msg := range messages {
+		chatReq.Messages[i].Role = msg.Role
+		chatReq.Messages[i].Content = msg.Content
+	}
+	tokenCount := NumTokensFromMessages(messages)
+	if tokenCount > c.ContextLength-responseTokenReserve {
 		slog.Warn("input token count is very close or bigger than context length", "tokens", tokenCount, "context-length", c.ContextLength)
 		if strings.Split(c.Model, ":")[0] == "llama3-gradient" {
 			slog.Info("since you are using the llama3-gradient model the context length will be automatically adjusted for the bigger token count")
-			chatReq.Options["num_ctx"] = tokenCount + 500
+			chatReq.Options["num_ctx"] = tokenCount + responseTokenReserve
 		}
 	}
 	res, err := json.Marshal(&chatReq)
 	if err != nil {
 		return "", fmt.Errorf("could not encode request JSON body: %w", err)
 	}
-	httpReq, err := http.NewRequest("POST", "http://"+c.Address+"/api/chat", bytes.NewReader(res))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", "http://"+c.Address+"/api/chat", bytes.NewReader(res))
 	if err != nil {
 		return "", fmt.Errorf("could not create Ollama HTTP request: %w", err)
 	}
@@ -134,6 +150,7 @@ func (c *OllamaClient) Summarize(lines []transcribe.Line) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("could request summary via Ollama HTTP API: %w", err)
 	}
+	defer httpResp.Body.Close()
 	body, err := io.ReadAll(httpResp.Body)
 	if err != nil {
 		return "", fmt.Errorf("error while reading response from Ollama: %w", err)
@@ -156,7 +173,7 @@ type OllamaPullRequest struct {
 }
 
 // UpdateModel updates the Ollama model by pulling it.
-func (c *OllamaClient) UpdateModel() error {
+func (c *OllamaClient) UpdateModel(ctx context.Context) error {
 	body, err := json.Marshal(&OllamaPullRequest{
 		Name:     c.Model,
 		Insecure: false,
@@ -165,7 +182,7 @@ func (c *OllamaClient) UpdateModel() error {
 	if err != nil {
 		return fmt.Errorf("could not encode request JSON body: %w", err)
 	}
-	httpReq, err := http.NewRequest("POST", "http://"+c.Address+"/api/pull", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", "http://"+c.Address+"/api/pull", bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("could not create Ollama HTTP request: %w", err)
 	}
@@ -174,6 +191,7 @@ func (c *OllamaClient) UpdateModel() error {
 	if err != nil {
 		return fmt.Errorf("could request model update via Ollama HTTP API: %w", err)
 	}
+	defer httpResp.Body.Close()
 	body, err = io.ReadAll(httpResp.Body)
 	if err != nil {
 		return fmt.Errorf("error while reading response from Ollama: %w", err)
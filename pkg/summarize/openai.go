@@ -7,21 +7,43 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
-	"strings"
 
+	"github.com/MrWong99/summairpg/pkg/config"
 	"github.com/MrWong99/summairpg/pkg/transcribe"
 	"github.com/sashabaranov/go-openai"
 )
 
+// OpenAIBackend is the name under which the OpenAIClient is registered.
+const OpenAIBackend = "openai"
+
+func init() {
+	Register(OpenAIBackend, func(ctx context.Context, cfg *config.App) (Summarizer, error) {
+		if _, ok := os.LookupEnv("OPENAI_API_KEY"); !ok {
+			return nil, errors.New("when using the OpenAI API you must set the environment variable OPENAI_API_KEY")
+		}
+		oc := NewOpenAIClient(cfg.OpenAI.Url, cfg.OpenAI.Model, cfg.OpenAI.OrgId, cfg.OpenAI.ApiType, cfg.OpenAI.ApiVersion)
+		if cfg.OpenAI.ContextLength > 0 {
+			oc.ContextLength = cfg.OpenAI.ContextLength
+		}
+		slog.Info("using OpenAI for summarization", "model", cfg.OpenAI.Model, "url", cfg.OpenAI.Url)
+		return oc, nil
+	})
+}
+
 // OpenAIClient to use when addressing the OpenAI API.
 type OpenAIClient struct {
 	// Client to use.
 	Client *openai.Client
 	// Model of AI to use.
 	Model string
+	// ContextLength is the maximum amount of tokens that will be sent in one request.
+	ContextLength int
 }
 
-// NewOpenAIClient creates a new OpenAIClient using the http.DefaultClient
+// DefaultOpenAIContextLength is the context length used by NewOpenAIClient.
+const DefaultOpenAIContextLength = 32000
+
+// NewOpenAIClient creates a new OpenAIClient using the http.DefaultClient and the DefaultOpenAIContextLength.
 func NewOpenAIClient(baseUrl, model, orgId string, apiType openai.APIType, apiVersion string) *OpenAIClient {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	config := openai.DefaultConfig(apiKey)
@@ -31,34 +53,23 @@ func NewOpenAIClient(baseUrl, model, orgId string, apiType openai.APIType, apiVe
 	config.APIVersion = apiVersion
 	config.HTTPClient = http.DefaultClient
 	return &OpenAIClient{
-		Client: openai.NewClientWithConfig(config),
-		Model:  model,
+		Client:        openai.NewClientWithConfig(config),
+		Model:         model,
+		ContextLength: DefaultOpenAIContextLength,
 	}
 }
 
 // Summarize the given lines of text using a special system prompt.
-func (c *OpenAIClient) Summarize(lines []transcribe.Line) (string, error) {
-	// TODO: split by tokens so not to overload the AI
-	fullText := ""
-	for _, line := range lines {
-		fullText += "\n" + line.String()
-	}
-	fullText = strings.TrimPrefix(fullText, "\n")
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    "system",
-			Content: summarySystemPrompt,
-		},
-		{
-			Role:    "user",
-			Content: fullText,
-		},
-	}
+// If the lines don't fit into the ContextLength they will be summarized in chunks that are merged afterwards.
+func (c *OpenAIClient) Summarize(ctx context.Context, lines []transcribe.Line, opts Options) (string, error) {
+	return mapReduce(ctx, c.chat, lines, c.ContextLength, opts)
+}
+
+func (c *OpenAIClient) chat(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
 	tokenCount := NumTokensFromMessages(messages)
-	if tokenCount > 32000 {
-		slog.Warn("input token count is bigger than 32K", "tokens", tokenCount)
+	if tokenCount > c.ContextLength-responseTokenReserve {
+		slog.Warn("input token count is very close or bigger than context length", "tokens", tokenCount, "context-length", c.ContextLength)
 	}
-	ctx := context.Background()
 	resp, err := c.Client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model:    c.Model,
 		Messages: messages,
@@ -0,0 +1,57 @@
+package summarize
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/MrWong99/summairpg/pkg/config"
+)
+
+// Factory creates a Summarizer using the settings of the App config.
+// The context cancels any setup the backend needs, like pulling a model.
+type Factory func(ctx context.Context, cfg *config.App) (Summarizer, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+// Register makes a Summarizer backend available by the provided name.
+// If Register is called twice with the same name or if factory is nil, it panics.
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if factory == nil {
+		panic("summarize: Register factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("summarize: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// Backends returns a sorted list of the names of all registered backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// New creates the Summarizer of the backend registered by name.
+func New(ctx context.Context, name string, cfg *config.App) (Summarizer, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown summary backend %q, must be one of %s", name, strings.Join(Backends(), ", "))
+	}
+	return factory(ctx, cfg)
+}
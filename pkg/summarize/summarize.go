@@ -1,8 +1,12 @@
 package summarize
 
 import (
+	"context"
 	_ "embed"
+	"strings"
+	"sync"
 
+	"github.com/MrWong99/summairpg/pkg/transcribe"
 	"github.com/pkoukk/tiktoken-go"
 	tokenLoader "github.com/pkoukk/tiktoken-go-loader"
 	"github.com/sashabaranov/go-openai"
@@ -15,9 +19,74 @@ func init() {
 //go:embed summary_system_prompt.txt
 var summarySystemPrompt string
 
+// Summarizer creates a summary of a transcribed role-play session.
+type Summarizer interface {
+	// Summarize the given lines of text.
+	Summarize(ctx context.Context, lines []transcribe.Line, opts Options) (string, error)
+}
+
+// Options for a single Summarize call.
+type Options struct {
+	// SystemPrompt overrides the default system prompt used to summarize the transcript if not empty.
+	SystemPrompt string
+	// ReducePrompt overrides the default system prompt used to merge partial summaries if not empty.
+	ReducePrompt string
+	// Checkpoint stores every answer of the AI so an interrupted summary can be continued. Can be nil.
+	Checkpoint Checkpoint
+	// Language the summary should be written in as ISO 639-1 code (e.g. de) or name. If empty the AI uses the language of the transcript.
+	Language string
+}
+
+func (o Options) systemPrompt() string {
+	if o.SystemPrompt != "" {
+		return o.SystemPrompt + o.languageInstruction()
+	}
+	return summarySystemPrompt + o.languageInstruction()
+}
+
+func (o Options) reducePrompt() string {
+	if o.ReducePrompt != "" {
+		return o.ReducePrompt + o.languageInstruction()
+	}
+	return reduceSystemPrompt + o.languageInstruction()
+}
+
+// languageNames are the English names of common languages by their ISO 639-1 code.
+var languageNames = map[string]string{
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"it": "Italian",
+	"ja": "Japanese",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"zh": "Chinese",
+}
+
+// languageInstruction returns an additional paragraph for the system prompts that tells the AI which language to use.
+func (o Options) languageInstruction() string {
+	if o.Language == "" {
+		return ""
+	}
+	language, ok := languageNames[strings.ToLower(o.Language)]
+	if !ok {
+		language = o.Language
+	}
+	return "\n\nThe transcript may contain several languages, but you must always answer in " + language + "!"
+}
+
+// encoding is only created once since building the BPE ranks is rather expensive.
+var encoding = sync.OnceValue(func() *tiktoken.Tiktoken {
+	tkm, _ := tiktoken.GetEncoding("cl100k_base")
+	return tkm
+})
+
 // NumTokensFromMessages gives a rough token count estimate.
 func NumTokensFromMessages(messages []openai.ChatCompletionMessage) (numTokens int) {
-	tkm, _ := tiktoken.GetEncoding("cl100k_base")
+	tkm := encoding()
 
 	tokensPerMessage := 3
 	tokensPerName := 1
@@ -34,3 +103,8 @@ func NumTokensFromMessages(messages []openai.ChatCompletionMessage) (numTokens i
 	numTokens += 3 // every reply is primed with <|start|>assistant<|message|>
 	return numTokens
 }
+
+// numTokens gives a rough token count estimate for a single text.
+func numTokens(text string) int {
+	return len(encoding().Encode(text, nil, nil))
+}
@@ -0,0 +1,224 @@
+package transcribe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// cacheVersion must be increased whenever the cached data structure (e.g. Word) changes.
+const cacheVersion = 5
+
+const (
+	// transcriptsCacheDir is the subdirectory of the cache directory that contains the cached transcriptions.
+	transcriptsCacheDir = "transcripts"
+	// AudioCacheDir is the subdirectory of the cache directory that contains the preprocessed audio files (see PreprocessOptions.Dir).
+	AudioCacheDir = "audio"
+)
+
+// cacheFilePatterns maps the subdirectories of the cache directory to the names of the files that are created in them.
+// Only these files are removed by PruneCache, so a misconfigured cache directory never loses unrelated files.
+var cacheFilePatterns = map[string]*regexp.Regexp{
+	transcriptsCacheDir: regexp.MustCompile(`^[0-9a-f]{64}\.json$`),
+	AudioCacheDir:       regexp.MustCompile(`^[0-9a-f]{64}\.wav$`),
+}
+
+// Fingerprinter is implemented by every Transcriber that can be cached.
+type Fingerprinter interface {
+	// Fingerprint returns a string that identifies the engine and all options that influence the transcription result.
+	Fingerprint() string
+}
+
+// fingerprint creates a Fingerprint from the engine name and its settings encoded as JSON.
+func fingerprint(engine string, settings any) string {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Sprintf("%s %+v", engine, settings)
+	}
+	return engine + " " + string(encoded)
+}
+
+// DefaultCacheDir returns the summairpg directory inside the users cache directory.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "summairpg"), nil
+}
+
+// CachedTranscriber stores the results of its Transcriber in a persistent cache.
+// Entries are addressed by the content hash of the audio file and the Fingerprint of the Transcriber,
+// so renaming or moving an audio file will still hit the cache.
+type CachedTranscriber struct {
+	// Transcriber to use when the cache does not contain a result yet.
+	Transcriber interface {
+		Transcriber
+		Fingerprinter
+	}
+	// Dir is the cache directory.
+	Dir string
+	// Refresh will ignore existing cache entries and overwrite them with a new transcription.
+	Refresh bool
+}
+
+type cacheEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Filename    string `json:"filename"`
+	// Nickname of the AudioFile when the entry was created.
+	Nickname string `json:"nickname"`
+	Words    []Word `json:"words"`
+}
+
+// Fingerprint returns the Fingerprint of the wrapped Transcriber, so multiple caches can be stacked.
+func (c *CachedTranscriber) Fingerprint() string {
+	return c.Transcriber.Fingerprint()
+}
+
+// Transcribe the file or return the cached result of a previous transcription.
+func (c *CachedTranscriber) Transcribe(ctx context.Context, file AudioFile) ([]Word, error) {
+	fp := c.Transcriber.Fingerprint()
+	if file.Language != "" {
+		fp += " language=" + file.Language
+	}
+	key, err := cacheKey(file.Filename, fp)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cache key: %w", err)
+	}
+	entryFile := filepath.Join(c.Dir, transcriptsCacheDir, key+".json")
+	if !c.Refresh {
+		words, err := readCacheEntry(entryFile, file.Nickname)
+		switch {
+		case err == nil:
+			slog.Info("using cached transcription", "file", file.Filename, "cache-entry", entryFile)
+			return words, nil
+		case !errors.Is(err, os.ErrNotExist):
+			slog.Warn("could not read cache entry, transcribing again", "file", file.Filename, "cache-entry", entryFile, "error", err)
+		}
+	}
+
+	words, err := c.Transcriber.Transcribe(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCacheEntry(entryFile, cacheEntry{
+		Fingerprint: fp,
+		Filename:    file.Filename,
+		Nickname:    file.Nickname,
+		Words:       words,
+	}); err != nil {
+		slog.Warn("could not store transcription in cache", "file", file.Filename, "cache-entry", entryFile, "error", err)
+	}
+	return words, nil
+}
+
+func cacheKey(filename, fingerprint string) (string, error) {
+	fileHash, err := hashFile(filename)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "v%d\n%s\n%s", cacheVersion, fileHash, fingerprint)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readCacheEntry returns the cached words. Words that had the nickname of the AudioFile when they were cached
+// will get the given nickname, so speaker labels from diarization are kept.
+func readCacheEntry(entryFile, nickname string) ([]Word, error) {
+	f, err := os.Open(entryFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entry cacheEntry
+	if err := json.NewDecoder(f).Decode(&entry); err != nil {
+		return nil, err
+	}
+	for i := range entry.Words {
+		if entry.Words[i].Nickname == entry.Nickname {
+			entry.Words[i].Nickname = nickname
+		}
+	}
+	// mark the entry as recently used so it will survive pruning
+	now := time.Now()
+	if err := os.Chtimes(entryFile, now, now); err != nil {
+		slog.Debug("could not update modification time of cache entry", "cache-entry", entryFile, "error", err)
+	}
+	return entry.Words, nil
+}
+
+func writeCacheEntry(entryFile string, entry cacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(entryFile), 0755); err != nil {
+		return err
+	}
+	// write to a temporary file first so parallel or aborted runs never leave a broken entry
+	tmp, err := os.CreateTemp(filepath.Dir(entryFile), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(&entry); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), entryFile)
+}
+
+// PruneCache removes all cache entries and preprocessed audio files in dir that have not been used for longer than maxAge.
+// If maxAge is 0 all entries are removed. Returns the amount of removed entries.
+// Only files named by their hash in the subdirectories created by the cache are considered, all other files in dir are kept.
+func PruneCache(dir string, maxAge time.Duration) (int, error) {
+	removed := 0
+	deadline := time.Now().Add(-maxAge)
+	for subdir, pattern := range cacheFilePatterns {
+		entries, err := os.ReadDir(filepath.Join(dir, subdir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !pattern.MatchString(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return removed, err
+			}
+			if maxAge > 0 && info.ModTime().After(deadline) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, subdir, entry.Name())); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
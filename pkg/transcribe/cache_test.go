@@ -0,0 +1,87 @@
+package transcribe
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneCache(t *testing.T) {
+	hash := strings.Repeat("0123456789abcdef", 4)
+	oldHash := strings.Repeat("fedcba9876543210", 4)
+	tests := []struct {
+		name        string
+		maxAge      time.Duration
+		wantRemoved []string
+	}{
+		{
+			name:        "everything",
+			maxAge:      0,
+			wantRemoved: []string{"transcripts/" + hash + ".json", "transcripts/" + oldHash + ".json", "audio/" + hash + ".wav"},
+		},
+		{
+			name:        "unused entries",
+			maxAge:      time.Hour,
+			wantRemoved: []string{"transcripts/" + oldHash + ".json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := []string{
+				"transcripts/" + hash + ".json",
+				"transcripts/" + oldHash + ".json",
+				"audio/" + hash + ".wav",
+				// files of the user that must survive if the cache dir points to a recordings or output folder
+				"session.wav",
+				"transcript.json",
+				"recordings/" + hash + ".wav",
+				"transcripts/notes.json",
+				"transcripts/" + hash + ".txt",
+				"audio/GameMaster.wav",
+				"audio/" + hash + ".json",
+			}
+			for _, file := range files {
+				path := filepath.Join(dir, filepath.FromSlash(file))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			old := time.Now().Add(-2 * time.Hour)
+			if err := os.Chtimes(filepath.Join(dir, "transcripts", oldHash+".json"), old, old); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := PruneCache(dir, tt.maxAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != len(tt.wantRemoved) {
+				t.Errorf("removed %d files, want %d", removed, len(tt.wantRemoved))
+			}
+			for _, file := range files {
+				_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file)))
+				wantRemoved := slices.Contains(tt.wantRemoved, file)
+				if wantRemoved && err == nil {
+					t.Errorf("%s was not removed", file)
+				}
+				if !wantRemoved && err != nil {
+					t.Errorf("%s was removed: %v", file, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneCacheMissingDir(t *testing.T) {
+	removed, err := PruneCache(filepath.Join(t.TempDir(), "missing"), 0)
+	if err != nil || removed != 0 {
+		t.Errorf("got %d, %v, want 0 and no error", removed, err)
+	}
+}
@@ -0,0 +1,288 @@
+package transcribe
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// chunkWindow is the resolution of the power envelope that is used to find silences.
+	chunkWindow = 100 * time.Millisecond
+	// chunkSilenceWindows is the amount of chunkWindows that form the span whose power is minimized to find a silence (1s).
+	chunkSilenceWindows = 10
+	// chunkSearchFraction is the fraction of ChunkOptions.MaxLength at the end of each chunk that is searched for a silence.
+	chunkSearchFraction = 0.1
+)
+
+// ChunkOptions configure how long audio files are split before they are transcribed.
+type ChunkOptions struct {
+	// MaxLength of a chunk. Audio files that are not longer are transcribed as a whole.
+	MaxLength time.Duration
+	// Dir is the directory that the chunks are temporarily written to. If empty the default directory for temporary files is used.
+	Dir string
+	// Concurrency is the maximum amount of chunks of one audio file that are transcribed in parallel. Values below 1 are treated as 1.
+	Concurrency int
+}
+
+// ChunkedTranscriber splits WAV and FLAC files that are longer than ChunkOptions.MaxLength into chunks at silences,
+// so the transcription engine does not run out of memory on recordings that last several hours.
+// The words of all chunks are merged as if the file was transcribed as a whole.
+// Other formats are transcribed as a whole, use a PreprocessedTranscriber around the ChunkedTranscriber to convert them first.
+type ChunkedTranscriber struct {
+	// Transcriber that transcribes the chunks.
+	Transcriber interface {
+		Transcriber
+		Fingerprinter
+	}
+	// Options for the chunks.
+	Options ChunkOptions
+}
+
+// Transcribe the audio file in chunks if it is longer than ChunkOptions.MaxLength.
+// The Word.StartTime, Word.EndTime and Word.Segment of each chunk are shifted to the position of the chunk in the file.
+func (c *ChunkedTranscriber) Transcribe(ctx context.Context, file AudioFile) ([]Word, error) {
+	if c.Options.MaxLength <= 0 {
+		return c.Transcriber.Transcribe(ctx, file)
+	}
+	dir, err := os.MkdirTemp(c.Options.Dir, ".chunks-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	chunks, err := splitAudio(ctx, file.Filename, c.Options.MaxLength, dir)
+	if errors.Is(err, ErrUnsupportedAudio) {
+		slog.Warn("audio track can not be split into chunks and is transcribed as a whole", "file", file.Filename, "error", err)
+		return c.Transcriber.Transcribe(ctx, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not split audio file into chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return c.Transcriber.Transcribe(ctx, file)
+	}
+	slog.Info("audio track split into chunks", "file", file.Filename, "chunks", len(chunks))
+
+	results := make([][]Word, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, max(c.Options.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return
+			}
+			slog.Info("transcribing chunk", "file", file.Filename, "chunk", i+1, "of", len(chunks), "start", time.Duration(chunk.start*float64(time.Second)).Round(time.Second))
+			chunkFile := file
+			chunkFile.Filename = chunk.filename
+			words, err := c.Transcriber.Transcribe(ctx, chunkFile)
+			if err != nil {
+				errs[i] = fmt.Errorf("chunk %d: %w", i+1, err)
+				return
+			}
+			results[i] = words
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	allWords := make([]Word, 0)
+	segments := 0
+	for i, words := range results {
+		lastSegment := 0
+		for _, word := range words {
+			word.StartTime += chunks[i].start
+			if word.EndTime != 0 {
+				word.EndTime += chunks[i].start
+			}
+			if word.Segment != 0 {
+				lastSegment = max(lastSegment, word.Segment)
+				word.Segment += segments
+			}
+			allWords = append(allWords, word)
+		}
+		segments += lastSegment
+	}
+	return allWords, nil
+}
+
+// Fingerprint returns the Fingerprint of the wrapped Transcriber together with the maximum length of the chunks.
+func (c *ChunkedTranscriber) Fingerprint() string {
+	if c.Options.MaxLength <= 0 {
+		return c.Transcriber.Fingerprint()
+	}
+	return c.Transcriber.Fingerprint() + " chunk=" + c.Options.MaxLength.String()
+}
+
+// audioChunk is a part of an audio file.
+type audioChunk struct {
+	filename string
+	// start of the chunk in seconds relative to the beginning of the audio file.
+	start float64
+}
+
+// splitAudio writes the chunks of the WAV or FLAC file to dir as 16 bit mono WAV files.
+// Returns no chunks if the file is not longer than maxLength.
+func splitAudio(ctx context.Context, filename string, maxLength time.Duration, dir string) ([]audioChunk, error) {
+	dec, err := openAudio(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { dec.Close() }()
+	rate := dec.SampleRate()
+	if n := dec.NSamples(); n > 0 && float64(n)/float64(rate) <= maxLength.Seconds() {
+		return nil, nil
+	}
+	envelope, total, err := powerEnvelope(ctx, dec)
+	if err != nil {
+		return nil, err
+	}
+	if float64(total)/float64(rate) <= maxLength.Seconds() {
+		return nil, nil
+	}
+	windowSamples := int64(float64(rate) * chunkWindow.Seconds())
+	maxWindows := int(maxLength / chunkWindow)
+	starts := chunkStarts(envelope, maxWindows)
+
+	// decode the file a second time to write the chunks
+	if err := dec.Close(); err != nil {
+		return nil, err
+	}
+	dec, err = openAudio(filename)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]audioChunk, len(starts))
+	for i, start := range starts {
+		end := total
+		if i+1 < len(starts) {
+			end = int64(starts[i+1]) * windowSamples
+		}
+		samples := end - int64(start)*windowSamples
+		chunks[i] = audioChunk{
+			filename: filepath.Join(dir, strconv.Itoa(i+1)+".wav"),
+			start:    float64(int64(start)*windowSamples) / float64(rate),
+		}
+		if err := writeWav(ctx, chunks[i].filename, dec, samples); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// powerEnvelope returns the power of every chunkWindow of the audio and the total amount of samples.
+func powerEnvelope(ctx context.Context, dec audioDecoder) ([]float64, int64, error) {
+	window := make([]float64, max(int(float64(dec.SampleRate())*chunkWindow.Seconds()), 1))
+	envelope := make([]float64, 0)
+	total := int64(0)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		n, err := readWindow(dec, window)
+		if n > 0 {
+			total += int64(n)
+			envelope = append(envelope, meanSquare(window[:n]))
+		}
+		if errors.Is(err, io.EOF) {
+			return envelope, total, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// chunkStarts returns the index of the first window of each chunk, so that no chunk is longer than maxWindows.
+// Each chunk ends in the middle of the quietest span of chunkSilenceWindows within the last chunkSearchFraction of its maximum length.
+func chunkStarts(envelope []float64, maxWindows int) []int {
+	maxWindows = max(maxWindows, 1)
+	search := max(int(float64(maxWindows)*chunkSearchFraction), 1)
+	starts := []int{0}
+	for start := 0; len(envelope)-start > maxWindows; {
+		latest := start + maxWindows
+		best, bestPower := latest, math.Inf(1)
+		for end := latest - search; end <= latest; end++ {
+			if end <= start {
+				continue
+			}
+			// the power of the span of windows that is centered on end
+			from, to := max(end-chunkSilenceWindows/2, start), min(end+chunkSilenceWindows/2, len(envelope))
+			power := 0.0
+			for _, p := range envelope[from:to] {
+				power += p
+			}
+			power /= float64(to - from)
+			if power < bestPower {
+				best, bestPower = end, power
+			}
+		}
+		starts = append(starts, best)
+		start = best
+	}
+	return starts
+}
+
+// writeWav writes the next samples of the decoder to a 16 bit mono WAV file.
+func writeWav(ctx context.Context, filename string, dec audioDecoder, samples int64) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	rate := uint32(dec.SampleRate())
+	dataSize := uint32(samples * 2)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(wavFormatPCM), uint16(1), rate, rate * 2, uint16(2), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	window := make([]float64, dec.SampleRate())
+	buf := make([]byte, 2*len(window))
+	for samples > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := readWindow(dec, window[:min(int64(len(window)), samples)])
+		for i, s := range window[:n] {
+			binary.LittleEndian.PutUint16(buf[2*i:], uint16(int16(math.Round(max(-1, min(s, 1))*math.MaxInt16))))
+		}
+		if _, err := w.Write(buf[:2*n]); err != nil {
+			return err
+		}
+		samples -= int64(n)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,155 @@
+package transcribe
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// silentEnvelope returns an envelope of n windows with a power of 1 that is silent from the windows silences[i] to silences[i+1].
+func silentEnvelope(n int, silences ...int) []float64 {
+	envelope := make([]float64, n)
+	for i := range envelope {
+		envelope[i] = 1
+	}
+	for i := 0; i+1 < len(silences); i += 2 {
+		for j := silences[i]; j < silences[i+1]; j++ {
+			envelope[j] = 0
+		}
+	}
+	return envelope
+}
+
+func TestChunkStarts(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	noise := make([]float64, 1234)
+	for i := range noise {
+		noise[i] = random.Float64()
+	}
+	// the power decreases towards window 96 and increases again after it
+	valley := make([]float64, 150)
+	for i := range valley {
+		valley[i] = math.Abs(float64(i - 96))
+	}
+	tests := []struct {
+		name       string
+		envelope   []float64
+		maxWindows int
+		// want are the expected starts, nil only checks that the chunks are not longer than maxWindows.
+		want []int
+	}{
+		{name: "not longer than max", envelope: silentEnvelope(100), maxWindows: 100, want: []int{0}},
+		{name: "cut in the middle of the silences", envelope: silentEnvelope(250, 90, 100, 185, 195), maxWindows: 100, want: []int{0, 95, 190}},
+		{name: "silence before the searched span is ignored", envelope: silentEnvelope(150, 40, 60), maxWindows: 100, want: []int{0, 90}},
+		{name: "cut at the quietest span", envelope: valley, maxWindows: 100, want: []int{0, 96}},
+		{name: "noise", envelope: noise, maxWindows: 100},
+		{name: "short max", envelope: noise, maxWindows: 3},
+		{name: "max of a single window", envelope: noise[:20], maxWindows: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starts := chunkStarts(tt.envelope, tt.maxWindows)
+			if tt.want != nil && !slices.Equal(starts, tt.want) {
+				t.Errorf("got starts %v, want %v", starts, tt.want)
+			}
+			if len(starts) == 0 || starts[0] != 0 {
+				t.Fatalf("got starts %v, want the first chunk to start at 0", starts)
+			}
+			for i, start := range starts {
+				end := len(tt.envelope)
+				if i+1 < len(starts) {
+					end = starts[i+1]
+				}
+				if end <= start {
+					t.Errorf("chunk %d starts at %d after the next chunk at %d", i, start, end)
+				}
+				if end-start > max(tt.maxWindows, 1) {
+					t.Errorf("chunk %d has %d windows, more than %d", i, end-start, tt.maxWindows)
+				}
+			}
+		})
+	}
+}
+
+// stubTranscriber returns two words in two segments and one word without a segment for every chunk.
+type stubTranscriber struct {
+	mu sync.Mutex
+	// durations of the transcribed files by their base name.
+	durations map[string]time.Duration
+}
+
+func (s *stubTranscriber) Transcribe(ctx context.Context, file AudioFile) ([]Word, error) {
+	info, err := ProbeAudio(ctx, file.Filename, -60)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(file.Filename)
+	s.mu.Lock()
+	s.durations[name] = info.Duration
+	s.mu.Unlock()
+	return []Word{
+		{Nickname: file.Nickname, Text: name, StartTime: 0.5, EndTime: 1, Segment: 1},
+		{Nickname: file.Nickname, Text: "and", StartTime: 2},
+		{Nickname: file.Nickname, Text: "more", StartTime: 3, EndTime: 3.5, Segment: 2},
+	}, nil
+}
+
+func (s *stubTranscriber) Fingerprint() string {
+	return "stub"
+}
+
+func TestChunkedTranscriber(t *testing.T) {
+	// a tone of 25s with silences from 9s to 10s and from 18.5s to 19.5s, so the chunks start at 0s, 9.5s and 19s
+	signal := make([]float64, 25*testSampleRate)
+	for i := range signal {
+		if s := float64(i) / testSampleRate; (s < 9 || s >= 10) && (s < 18.5 || s >= 19.5) {
+			signal[i] = testAmplitude * math.Sin(2*math.Pi*440*s)
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "1-gmuser.wav")
+	writeTestWav(t, filename, wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1}, signal)
+	file := AudioFile{Filename: filename, Nickname: "GameMaster"}
+
+	stub := &stubTranscriber{durations: make(map[string]time.Duration)}
+	c := &ChunkedTranscriber{Transcriber: stub, Options: ChunkOptions{MaxLength: 10 * time.Second, Dir: t.TempDir(), Concurrency: 2}}
+	words, err := c.Transcribe(context.Background(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]Word, 0)
+	for i, start := range []float64{0, 9.5, 19} {
+		segment := 2 * i
+		want = append(want,
+			Word{Nickname: "GameMaster", Text: []string{"1.wav", "2.wav", "3.wav"}[i], StartTime: start + 0.5, EndTime: start + 1, Segment: segment + 1},
+			Word{Nickname: "GameMaster", Text: "and", StartTime: start + 2},
+			Word{Nickname: "GameMaster", Text: "more", StartTime: start + 3, EndTime: start + 3.5, Segment: segment + 2},
+		)
+	}
+	if !slices.Equal(words, want) {
+		t.Errorf("got words %+v, want %+v", words, want)
+	}
+	total := time.Duration(0)
+	for name, duration := range stub.durations {
+		if duration > c.Options.MaxLength {
+			t.Errorf("chunk %s is %s long, more than %s", name, duration, c.Options.MaxLength)
+		}
+		total += duration
+	}
+	if total != 25*time.Second {
+		t.Errorf("chunks are %s long in total, want 25s", total)
+	}
+
+	// files that are not longer than the maximum are transcribed as a whole
+	c.Options.MaxLength = time.Minute
+	if words, err = c.Transcribe(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 3 || words[0].Text != "1-gmuser.wav" || words[0].StartTime != 0.5 {
+		t.Errorf("got words %+v, want the words of the whole file", words)
+	}
+}
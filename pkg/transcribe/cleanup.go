@@ -0,0 +1,241 @@
+package transcribe
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// DefaultHallucinations are phrases that Whisper is known to hallucinate on silent or muted audio.
+var DefaultHallucinations = []string{
+	"Thank you for watching",
+	"Thanks for watching",
+	"Thank you for watching and see you next time",
+	"Please subscribe to my channel",
+	"Don't forget to like and subscribe",
+	"Subtitles by the Amara.org community",
+	"Transcription by CastingWords",
+	"Vielen Dank fürs Zuschauen",
+	"Untertitel im Auftrag des ZDF",
+	"Untertitelung des ZDF",
+	"Untertitel der Amara.org-Community",
+	"Sous-titrage Société Radio-Canada",
+	"Merci d'avoir regardé cette vidéo",
+	"Gracias por ver el video",
+}
+
+// The reasons why words were removed by Cleanup.
+const (
+	ReasonLowScore      = "low-score"
+	ReasonHallucination = "hallucination"
+	ReasonRepetition    = "repetition"
+)
+
+// hallucinationGap is the minimum silence in seconds around a hallucination phrase if it does not form an entire segment.
+const hallucinationGap = 2
+
+// CleanupOptions configure which words are removed by Cleanup.
+type CleanupOptions struct {
+	// MinScore is the minimum confidence score of a word. Words without a score (0) are always kept.
+	MinScore float64
+	// MaxRepeats is the maximum amount of direct repetitions of a phrase before it is considered a loop.
+	// All repetitions of a loop except the first one are removed. 0 disables the loop detection.
+	MaxRepeats int
+	// MaxPhraseLength is the maximum amount of words of a repeated phrase that is checked for loops.
+	MaxPhraseLength int
+	// Hallucinations are phrases that are removed when they are spoken on their own,
+	// meaning they form an entire segment or are surrounded by silence. Case and punctuation are ignored.
+	Hallucinations []string
+}
+
+// Removal are consecutive words of one speaker that were removed by Cleanup.
+type Removal struct {
+	// Reason is one of ReasonLowScore, ReasonHallucination or ReasonRepetition.
+	Reason string
+	// Words that were removed.
+	Words []Word
+}
+
+// CleanupReport lists everything that was removed by Cleanup.
+type CleanupReport struct {
+	Removals []Removal
+}
+
+// Count returns the amount of removed words for the given reason.
+func (r *CleanupReport) Count(reason string) int {
+	count := 0
+	for _, removal := range r.Removals {
+		if removal.Reason == reason {
+			count += len(removal.Words)
+		}
+	}
+	return count
+}
+
+// Cleanup removes words with low confidence, repeated loops and known hallucinations.
+// Each speaker is checked on their own so crosstalk does not interfere with the detection.
+// The order of the remaining words is kept.
+func Cleanup(words []Word, opts CleanupOptions) ([]Word, CleanupReport) {
+	var report CleanupReport
+	removed := make([]bool, len(words))
+	speakers := make(map[string][]int)
+	order := make([]string, 0)
+	for i, word := range words {
+		if _, ok := speakers[word.Nickname]; !ok {
+			order = append(order, word.Nickname)
+		}
+		speakers[word.Nickname] = append(speakers[word.Nickname], i)
+	}
+
+	hallucinations := make([][]string, 0, len(opts.Hallucinations))
+	for _, phrase := range opts.Hallucinations {
+		if tokens := tokenize(phrase); len(tokens) > 0 {
+			hallucinations = append(hallucinations, tokens)
+		}
+	}
+
+	for _, nickname := range order {
+		indices := speakers[nickname]
+		if opts.MinScore > 0 {
+			indices = removeLowScores(words, indices, opts.MinScore, removed, &report)
+		}
+		if len(hallucinations) > 0 {
+			indices = removeHallucinations(words, indices, hallucinations, removed, &report)
+		}
+		if opts.MaxRepeats > 0 {
+			removeRepetitions(words, indices, opts.MaxRepeats, max(opts.MaxPhraseLength, 1), removed, &report)
+		}
+	}
+
+	cleaned := make([]Word, 0, len(words))
+	for i, word := range words {
+		if !removed[i] {
+			cleaned = append(cleaned, word)
+		}
+	}
+	return cleaned, report
+}
+
+// removeLowScores marks all words below minScore as removed and returns the remaining indices.
+func removeLowScores(words []Word, indices []int, minScore float64, removed []bool, report *CleanupReport) []int {
+	remaining := make([]int, 0, len(indices))
+	var current []Word
+	for _, i := range indices {
+		if words[i].Score > 0 && words[i].Score < minScore {
+			removed[i] = true
+			current = append(current, words[i])
+			continue
+		}
+		if len(current) > 0 {
+			report.Removals = append(report.Removals, Removal{Reason: ReasonLowScore, Words: current})
+			current = nil
+		}
+		remaining = append(remaining, i)
+	}
+	if len(current) > 0 {
+		report.Removals = append(report.Removals, Removal{Reason: ReasonLowScore, Words: current})
+	}
+	return remaining
+}
+
+// removeHallucinations marks all isolated occurrences of the hallucination phrases as removed and returns the remaining indices.
+func removeHallucinations(words []Word, indices []int, hallucinations [][]string, removed []bool, report *CleanupReport) []int {
+	tokens := make([]string, len(indices))
+	for j, i := range indices {
+		tokens[j] = normalizeToken(words[i].Text)
+	}
+	drop := make([]bool, len(indices))
+	for _, phrase := range hallucinations {
+		for start := 0; start+len(phrase) <= len(tokens); start++ {
+			end := start + len(phrase)
+			if !slices.Equal(tokens[start:end], phrase) || !isolated(words, indices, start, end) {
+				continue
+			}
+			current := make([]Word, 0, len(phrase))
+			for j := start; j < end; j++ {
+				if !drop[j] {
+					drop[j] = true
+					current = append(current, words[indices[j]])
+				}
+			}
+			if len(current) > 0 {
+				report.Removals = append(report.Removals, Removal{Reason: ReasonHallucination, Words: current})
+			}
+		}
+	}
+	remaining := make([]int, 0, len(indices))
+	for j, i := range indices {
+		if drop[j] {
+			removed[i] = true
+			continue
+		}
+		remaining = append(remaining, i)
+	}
+	return remaining
+}
+
+// isolated returns true if the words indices[start:end] are not part of a longer sentence.
+// That is the case if they form an entire segment or are surrounded by silence.
+func isolated(words []Word, indices []int, start, end int) bool {
+	first, last := words[indices[start]], words[indices[end-1]]
+	beforeOk, afterOk := start == 0, end == len(indices)
+	if !beforeOk {
+		prev := words[indices[start-1]]
+		beforeOk = (first.Segment != 0 && prev.Segment != first.Segment) || first.StartTime-max(prev.EndTime, prev.StartTime) >= hallucinationGap
+	}
+	if !afterOk {
+		next := words[indices[end]]
+		afterOk = (last.Segment != 0 && next.Segment != last.Segment) || next.StartTime-max(last.EndTime, last.StartTime) >= hallucinationGap
+	}
+	return beforeOk && afterOk
+}
+
+// removeRepetitions marks all direct repetitions of phrases that are repeated more than maxRepeats times as removed.
+func removeRepetitions(words []Word, indices []int, maxRepeats, maxPhraseLength int, removed []bool, report *CleanupReport) {
+	tokens := make([]string, len(indices))
+	for j, i := range indices {
+		tokens[j] = normalizeToken(words[i].Text)
+	}
+	for start := 0; start < len(tokens); {
+		loopLength, loopRepeats := 0, 0
+		for n := 1; n <= maxPhraseLength && start+n <= len(tokens); n++ {
+			repeats := 1
+			for start+(repeats+1)*n <= len(tokens) && slices.Equal(tokens[start:start+n], tokens[start+repeats*n:start+(repeats+1)*n]) {
+				repeats++
+			}
+			if repeats > maxRepeats {
+				loopLength, loopRepeats = n, repeats
+				break
+			}
+		}
+		if loopLength == 0 {
+			start++
+			continue
+		}
+		current := make([]Word, 0, (loopRepeats-1)*loopLength)
+		for j := start + loopLength; j < start+loopRepeats*loopLength; j++ {
+			removed[indices[j]] = true
+			current = append(current, words[indices[j]])
+		}
+		report.Removals = append(report.Removals, Removal{Reason: ReasonRepetition, Words: current})
+		start += loopRepeats * loopLength
+	}
+}
+
+// tokenize splits the phrase into normalized tokens.
+func tokenize(phrase string) []string {
+	tokens := make([]string, 0)
+	for _, field := range strings.Fields(phrase) {
+		if token := normalizeToken(field); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// normalizeToken lowercases the word and removes all punctuation.
+func normalizeToken(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	}))
+}
@@ -0,0 +1,130 @@
+package transcribe
+
+import (
+	"strings"
+	"testing"
+)
+
+// spoken creates the words of the text spoken without pauses by the speaker, starting at start seconds.
+// Every word takes 0.5 seconds and has a score of 0.9.
+func spoken(nickname string, start float64, segment int, text string) []Word {
+	words := make([]Word, 0)
+	for _, field := range strings.Fields(text) {
+		words = append(words, Word{Nickname: nickname, Text: field, StartTime: start, EndTime: start + 0.4, Score: 0.9, Segment: segment})
+		start += 0.5
+	}
+	return words
+}
+
+func joinWords(parts ...[]Word) []Word {
+	words := make([]Word, 0)
+	for _, part := range parts {
+		words = append(words, part...)
+	}
+	return words
+}
+
+func TestCleanup(t *testing.T) {
+	lowScores := spoken("A", 0, 1, "the mumble unknown dragon")
+	lowScores[1].Score = 0.1
+	lowScores[2].Score = 0
+
+	interleaved := make([]Word, 0)
+	for i, answer := range []string{"yes", "sure", "ok"} {
+		interleaved = append(interleaved,
+			Word{Nickname: "A", Text: "no", StartTime: float64(i), EndTime: float64(i) + 0.4},
+			Word{Nickname: "B", Text: answer, StartTime: float64(i) + 0.5, EndTime: float64(i) + 0.9})
+	}
+
+	tests := []struct {
+		name  string
+		words []Word
+		opts  CleanupOptions
+		want  string
+		// wantCounts are the counts of the report by reason
+		wantCounts map[string]int
+	}{
+		{
+			name:       "low scores but unknown scores are kept",
+			words:      lowScores,
+			opts:       CleanupOptions{MinScore: 0.5},
+			want:       "the unknown dragon",
+			wantCounts: map[string]int{ReasonLowScore: 1},
+		},
+		{
+			name:  "min score disabled",
+			words: lowScores,
+			want:  "the mumble unknown dragon",
+		},
+		{
+			name:       "hallucination forming an entire segment",
+			words:      joinWords(spoken("A", 0, 1, "We rest."), spoken("A", 1, 2, "Thank you for watching."), spoken("A", 3, 3, "Then we go")),
+			opts:       CleanupOptions{Hallucinations: DefaultHallucinations},
+			want:       "We rest. Then we go",
+			wantCounts: map[string]int{ReasonHallucination: 4},
+		},
+		{
+			name:  "hallucination within a sentence",
+			words: spoken("A", 0, 1, "I said thank you for watching the show"),
+			opts:  CleanupOptions{Hallucinations: DefaultHallucinations},
+			want:  "I said thank you for watching the show",
+		},
+		{
+			name:       "hallucination surrounded by silence",
+			words:      joinWords(spoken("A", 0, 0, "We rest."), spoken("A", 5, 0, "thanks for watching"), spoken("A", 10, 0, "Then we go")),
+			opts:       CleanupOptions{Hallucinations: []string{"Thanks for watching!"}},
+			want:       "We rest. Then we go",
+			wantCounts: map[string]int{ReasonHallucination: 3},
+		},
+		{
+			name:  "hallucination without silence",
+			words: joinWords(spoken("A", 0, 0, "We rest."), spoken("A", 1, 0, "thanks for watching"), spoken("A", 2.5, 0, "Then we go")),
+			opts:  CleanupOptions{Hallucinations: []string{"Thanks for watching"}},
+			want:  "We rest. thanks for watching Then we go",
+		},
+		{
+			name:       "repeated word",
+			words:      spoken("A", 0, 1, "no no, no no no! Really"),
+			opts:       CleanupOptions{MaxRepeats: 2, MaxPhraseLength: 3},
+			want:       "no Really",
+			wantCounts: map[string]int{ReasonRepetition: 4},
+		},
+		{
+			name:       "repeated phrase",
+			words:      spoken("A", 0, 1, "we go I go I go I go I go home"),
+			opts:       CleanupOptions{MaxRepeats: 3, MaxPhraseLength: 3},
+			want:       "we go I go home",
+			wantCounts: map[string]int{ReasonRepetition: 6},
+		},
+		{
+			name:  "repetitions within the limit",
+			words: spoken("A", 0, 1, "no no I go I go"),
+			opts:  CleanupOptions{MaxRepeats: 2, MaxPhraseLength: 3},
+			want:  "no no I go I go",
+		},
+		{
+			name:       "repetitions are detected per speaker",
+			words:      interleaved,
+			opts:       CleanupOptions{MaxRepeats: 2, MaxPhraseLength: 1},
+			want:       "no yes sure ok",
+			wantCounts: map[string]int{ReasonRepetition: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleaned, report := Cleanup(tt.words, tt.opts)
+			texts := make([]string, len(cleaned))
+			for i, word := range cleaned {
+				texts[i] = word.Text
+			}
+			if got := strings.Join(texts, " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, reason := range []string{ReasonLowScore, ReasonHallucination, ReasonRepetition} {
+				if got := report.Count(reason); got != tt.wantCounts[reason] {
+					t.Errorf("report counts %d words removed for %s, want %d", got, reason, tt.wantCounts[reason])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package transcribe
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// craigInfoFile is the file in each Craig archive that contains the metadata of the recording.
+const craigInfoFile = "info.txt"
+
+var (
+	// craigTrackPattern matches the file stem of Craig tracks like 1-myuser or 1-myuser-0.
+	craigTrackPattern = regexp.MustCompile(`^(\d+)-(.+)$`)
+	// craigUserPattern matches a track in the info.txt like "myuser#1234 (123456789012345678)".
+	craigUserPattern = regexp.MustCompile(`^(.+?)(?:#\d+)?(?:\s+\(\d+\))?$`)
+)
+
+// CraigRecording is an extracted multitrack recording of the Craig Discord bot. See https://craig.chat
+type CraigRecording struct {
+	// Dir is the directory the archive was extracted to.
+	Dir string
+	// Usernames maps the file stem of each extracted audio track to the Discord username of its speaker.
+	Usernames map[string]string
+}
+
+// ExtractCraigArchive extracts all files of the Craig multitrack ZIP archive into dir.
+// The Discord usernames of the tracks are read from the info.txt of the archive.
+// If that is missing the usernames are taken from the track filenames instead.
+func ExtractCraigArchive(archive, dir string) (*CraigRecording, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("could not open archive %q: %w", archive, err)
+	}
+	defer r.Close()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	stems := make([]string, 0)
+	var trackUsers []string
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		// Craig archives are flat, so just use the base name which also prevents writing outside of dir
+		name := filepath.Base(f.Name)
+		if err := extractZipFile(f, filepath.Join(dir, name)); err != nil {
+			return nil, fmt.Errorf("could not extract %q: %w", f.Name, err)
+		}
+		if name == craigInfoFile {
+			if trackUsers, err = readCraigInfo(filepath.Join(dir, name)); err != nil {
+				return nil, fmt.Errorf("could not read %s: %w", craigInfoFile, err)
+			}
+			continue
+		}
+		stems = append(stems, fileStem(name))
+	}
+
+	rec := &CraigRecording{
+		Dir:       dir,
+		Usernames: make(map[string]string),
+	}
+	for _, stem := range stems {
+		match := craigTrackPattern.FindStringSubmatch(stem)
+		if match == nil {
+			continue
+		}
+		rec.Usernames[stem] = match[2]
+		if track, err := strconv.Atoi(match[1]); err == nil && track > 0 && track <= len(trackUsers) {
+			rec.Usernames[stem] = trackUsers[track-1]
+		}
+	}
+	return rec, nil
+}
+
+func extractZipFile(f *zip.File, dest string) error {
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readCraigInfo returns the usernames of all tracks listed in the info.txt in the order of their track numbers.
+func readCraigInfo(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := make([]string, 0)
+	inTracks := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if !inTracks {
+			inTracks = trimmed == "Tracks:"
+			continue
+		}
+		// the track list ends with the first line that is not indented
+		if trimmed == "" || trimmed == line {
+			break
+		}
+		match := craigUserPattern.FindStringSubmatch(trimmed)
+		if match == nil {
+			return nil, errors.New("invalid track line " + strconv.Quote(trimmed))
+		}
+		users = append(users, match[1])
+	}
+	return users, scanner.Err()
+}
@@ -0,0 +1,115 @@
+package transcribe
+
+import (
+	"archive/zip"
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testCraigInfo = `Recording abc123
+
+Guild:		Waterdeep Adventurers (123456789012345678)
+Channel:	Tavern (234567890123456789)
+Requester:	gmuser#0001 (345678901234567890)
+Start time:	2024-03-01T19:00:00.000Z
+
+Tracks:
+	gmuser#0001 (345678901234567890)
+	myuser (456789012345678901)
+	dice.bot#4242
+
+Notes:
+	0:12:34	the dragon appears
+`
+
+func TestReadCraigInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "tracks", info: testCraigInfo, want: []string{"gmuser", "myuser", "dice.bot"}},
+		{name: "no tracks", info: "Recording abc123\n\nGuild:\tWaterdeep Adventurers\n", want: []string{}},
+		{name: "tracks at end of file", info: "Tracks:\n  gmuser#0001 (1)\n  myuser\n", want: []string{"gmuser", "myuser"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), craigInfoFile)
+			if err := os.WriteFile(file, []byte(tt.info), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readCraigInfo(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractCraigArchive(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	entries := []struct {
+		name    string
+		content string
+	}{
+		{name: craigInfoFile, content: testCraigInfo},
+		{name: "1-gmuser.flac", content: "gm audio"},
+		{name: "2-myuser_0.flac", content: "my audio"},
+		{name: "3-dice.bot.flac", content: "dice audio"},
+		{name: "4-guest.flac", content: "guest audio"},
+		{name: "../../escaped.flac", content: "evil audio"},
+		{name: "raw.dat", content: "mixdown"},
+		{name: "nested/5-other.flac", content: "other audio"},
+	}
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	archive := filepath.Join(tmp, "craig.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "session", "extracted")
+	rec, err := ExtractCraigArchive(archive, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"1-gmuser":   "gmuser",
+		"2-myuser_0": "myuser",
+		"3-dice.bot": "dice.bot",
+		"4-guest":    "guest",
+		"5-other":    "other",
+	}
+	if !maps.Equal(rec.Usernames, want) {
+		t.Errorf("got usernames %v, want %v", rec.Usernames, want)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "escaped.flac"))
+	if err != nil || string(content) != "evil audio" {
+		t.Errorf("entry with ../ path was not flattened into the extraction dir: %v", err)
+	}
+	for _, outside := range []string{filepath.Join(tmp, "escaped.flac"), filepath.Join(tmp, "session", "escaped.flac")} {
+		if _, err := os.Stat(outside); err == nil {
+			t.Errorf("entry with ../ path was written outside of the extraction dir to %s", outside)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package transcribe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The supported transcript formats. The format name is also used as file extension.
+const (
+	// FormatText is the plain "Nickname: text" format that is also printed to console.
+	FormatText = "txt"
+	// FormatSRT is the SubRip subtitle format with the nickname prefixed to each cue.
+	FormatSRT = "srt"
+	// FormatVTT is the WebVTT subtitle format using voice tags for the nicknames.
+	FormatVTT = "vtt"
+	// FormatJSON is the canonical format that preserves every Word.
+	FormatJSON = "json"
+	// FormatMarkdown is a human readable format with timestamps.
+	FormatMarkdown = "md"
+)
+
+// Formats are all supported transcript formats.
+var Formats = []string{FormatText, FormatSRT, FormatVTT, FormatJSON, FormatMarkdown}
+
+// estimatedWordDuration is used as duration of the last word of a line if its end is unknown.
+const estimatedWordDuration = 0.5
+
+// vttEscaper escapes the characters that have a special meaning in WebVTT cue text.
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// JSONTranscript is the structure of the canonical JSON format.
+type JSONTranscript struct {
+	Lines []Line `json:"lines"`
+}
+
+// ExportFile writes the lines in the given format to the file dir/transcript.<format>.
+// Returns the name of the written file.
+func ExportFile(dir, format string, lines []Line) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(dir, "transcript."+format)
+	f, err := os.Create(filename)
+	if err != nil {
+		return "", err
+	}
+	w := bufio.NewWriter(f)
+	if err := Export(w, format, lines); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return "", err
+	}
+	return filename, f.Close()
+}
+
+// Export writes the lines in the given format. See Formats for all supported formats.
+func Export(w io.Writer, format string, lines []Line) error {
+	switch format {
+	case FormatText:
+		return exportText(w, lines)
+	case FormatSRT:
+		return exportSRT(w, lines)
+	case FormatVTT:
+		return exportVTT(w, lines)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(JSONTranscript{Lines: lines})
+	case FormatMarkdown:
+		return exportMarkdown(w, lines)
+	default:
+		return fmt.Errorf("unknown transcript format %q, must be one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+func exportText(w io.Writer, lines []Line) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportSRT(w io.Writer, lines []Line) error {
+	for i, line := range lines {
+		start, end := lineTimes(lines, i)
+		if _, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(start, ","), formatTimestamp(end, ","), line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportVTT(w io.Writer, lines []Line) error {
+	if _, err := fmt.Fprint(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for i, line := range lines {
+		start, end := lineTimes(lines, i)
+		if _, err := fmt.Fprintf(w, "%s --> %s\n<v %s>%s\n\n", formatTimestamp(start, "."), formatTimestamp(end, "."), vttEscaper.Replace(line.Nickname), vttEscaper.Replace(line.Text())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportMarkdown(w io.Writer, lines []Line) error {
+	if _, err := fmt.Fprint(w, "# Transcript\n\n"); err != nil {
+		return err
+	}
+	for i, line := range lines {
+		start, _ := lineTimes(lines, i)
+		if _, err := fmt.Fprintf(w, "**[%s] %s:** %s\n\n", formatTimestamp(start, ""), line.Nickname, line.Text()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineTimes returns the start and end of the i-th line in seconds.
+// If the end of the last word is unknown it is estimated but never exceeds the start of the next line.
+func lineTimes(lines []Line, i int) (start, end float64) {
+	line := lines[i]
+	if len(line.Words) == 0 {
+		return 0, 0
+	}
+	start, end = line.Start(), line.End()
+	if line.Words[len(line.Words)-1].EndTime == 0 {
+		end += estimatedWordDuration
+		if i+1 < len(lines) && len(lines[i+1].Words) > 0 {
+			if next := lines[i+1].Start(); next > start && next < end {
+				end = next
+			}
+		}
+	}
+	return start, end
+}
+
+// formatTimestamp formats the seconds as hh:mm:ss<sep>mmm. If sep is empty the milliseconds are omitted.
+func formatTimestamp(seconds float64, sep string) string {
+	millis := int64(seconds*1000 + 0.5)
+	if millis < 0 {
+		millis = 0
+	}
+	h := millis / 3600000
+	m := millis / 60000 % 60
+	s := millis / 1000 % 60
+	if sep == "" {
+		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, millis%1000)
+}
@@ -0,0 +1,113 @@
+package transcribe
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TrackFilter selects the audio tracks that are transcribed by their name,
+// e.g. to ignore the tracks of music or dice bots without deleting them.
+type TrackFilter struct {
+	// Include contains patterns of which at least one must match a track. If there are none all tracks are included.
+	Include []*regexp.Regexp
+	// Exclude contains patterns of which none must match a track.
+	Exclude []*regexp.Regexp
+}
+
+// NewTrackFilter compiles the include and exclude patterns and creates a new TrackFilter.
+// Patterns enclosed in slashes like /^\d+-.*bot$/ are regular expressions,
+// all other patterns are case-insensitive glob patterns like *bot* (see filepath.Match).
+// Patterns that start with a slash but do not end with one are rejected, as they are most likely regular expressions
+// that were split at a comma when the patterns were given as comma-separated list.
+func NewTrackFilter(include, exclude []string) (*TrackFilter, error) {
+	filter := &TrackFilter{}
+	var err error
+	if filter.Include, err = compileTrackPatterns(include); err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	if filter.Exclude, err = compileTrackPatterns(exclude); err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	return filter, nil
+}
+
+func compileTrackPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		expr := globToRegexp(pattern)
+		if strings.HasPrefix(pattern, "/") {
+			if len(pattern) < 2 || !strings.HasSuffix(pattern, "/") {
+				return nil, fmt.Errorf("%q: regular expression is not enclosed in slashes, it must not contain commas", pattern)
+			}
+			expr = pattern[1 : len(pattern)-1]
+		} else if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
+// globToRegexp converts the glob pattern to a case-insensitive regular expression that matches the whole name.
+func globToRegexp(glob string) string {
+	runes := []rune(glob)
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(runes[i])))
+			}
+		case '[':
+			end := slices.Index(runes[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := string(runes[i+1 : i+1+end])
+			// both [^...] of filepath.Match and [!...] of shells negate the class
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Matches returns true if the track should be transcribed.
+// The patterns are matched against the file name with and without extension and the nickname of the track.
+func (f *TrackFilter) Matches(file AudioFile) bool {
+	names := []string{filepath.Base(file.Filename), fileStem(file.Filename), file.Nickname}
+	matchesAny := func(patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			for _, name := range names {
+				if re.MatchString(name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if len(f.Include) > 0 && !matchesAny(f.Include) {
+		return false
+	}
+	return !matchesAny(f.Exclude)
+}
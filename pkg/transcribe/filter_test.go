@@ -0,0 +1,47 @@
+package transcribe
+
+import "testing"
+
+func TestTrackFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		filename string
+		nickname string
+		want     bool
+	}{
+		{name: "no patterns", filename: "1-alice.flac", nickname: "Alice", want: true},
+		{name: "excluded glob", exclude: []string{"*bot*"}, filename: "3-MusicBot.flac", nickname: "3-MusicBot", want: false},
+		{name: "excluded exact name", exclude: []string{"raw"}, filename: "raw.flac", nickname: "raw", want: false},
+		{name: "glob matches whole name", exclude: []string{"raw"}, filename: "0-raw.flac", nickname: "0-raw", want: true},
+		{name: "excluded regexp", exclude: []string{`/^\d+-dice/`}, filename: "4-dicebot.ogg", nickname: "4-dicebot", want: false},
+		{name: "excluded by nickname", exclude: []string{"Darell"}, filename: "2-myuser.flac", nickname: "Darell", want: false},
+		{name: "not included", include: []string{"1-*"}, filename: "2-bob.flac", nickname: "Bob", want: false},
+		{name: "included by file name", include: []string{"*.flac"}, filename: "2-bob.flac", nickname: "Bob", want: true},
+		{name: "non-ASCII glob", include: []string{"Jörg*"}, filename: "Jörg.flac", nickname: "Jörg", want: true},
+		{name: "non-ASCII case-insensitive", exclude: []string{"jörg"}, filename: "JÖRG.flac", nickname: "JÖRG", want: false},
+		{name: "non-ASCII single character", include: []string{"J?rg"}, filename: "Jörg.flac", nickname: "Jörg", want: true},
+		{name: "negated class", exclude: []string{"[!a]x"}, filename: "ax.wav", nickname: "ax", want: true},
+		{name: "negated class with caret", exclude: []string{"[^a]x"}, filename: "bx.wav", nickname: "bx", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewTrackFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Matches(AudioFile{Filename: "/session/" + tt.filename, Nickname: tt.nickname}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTrackFilterInvalid(t *testing.T) {
+	for _, pattern := range []string{"[a", "/(/", "/", `/^\d{1`, "/^raw"} {
+		if _, err := NewTrackFilter([]string{pattern}, nil); err == nil {
+			t.Errorf("pattern %q: expected an error", pattern)
+		}
+	}
+}
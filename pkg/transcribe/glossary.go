@@ -0,0 +1,225 @@
+package transcribe
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// glossaryMinLength is the minimum amount of letters of a glossary term or misheard phrase to be corrected.
+	// Shorter words are too likely to match by chance.
+	glossaryMinLength = 4
+	// glossaryExtraWords is the amount of words a misheard phrase may have more than the glossary term.
+	glossaryExtraWords = 2
+	// glossaryMaxSuffix is the maximum amount of letters of an inflection suffix like 's or German case endings
+	// that a misheard phrase may have beyond the glossary term. The suffix is kept when the phrase is replaced.
+	glossaryMaxSuffix = 3
+)
+
+// GlossaryPrompt creates an initial prompt for the transcription engine that contains all terms of the glossary,
+// so the engine is more likely to recognize them.
+func GlossaryPrompt(glossary []string) string {
+	if len(glossary) == 0 {
+		return ""
+	}
+	return strings.Join(glossary, ", ") + "."
+}
+
+type glossaryTerm struct {
+	text     string
+	words    int
+	letters  string
+	phonetic string
+}
+
+// ApplyGlossary replaces misheard words with the best matching glossary term, e.g. "Zanna tar" with "Xanathar".
+// Each sequence of consecutive words of one speaker is compared to all terms by spelling and by a rough phonetic key.
+// Sequences with a similarity of at least threshold (0 to 1) are replaced by a single word with the text of the term.
+// Inflection suffixes like "Zanna tar's" are kept ("Xanathar's") and inflected terms that are spelled correctly stay untouched.
+// Returns the corrected words and the amount of replacements.
+func ApplyGlossary(words []Word, glossary []string, threshold float64) ([]Word, int) {
+	terms := make([]glossaryTerm, 0, len(glossary))
+	for _, text := range glossary {
+		letters := lettersOnly(text)
+		if len([]rune(letters)) < glossaryMinLength {
+			continue
+		}
+		terms = append(terms, glossaryTerm{
+			text:     strings.TrimSpace(text),
+			words:    len(strings.Fields(text)),
+			letters:  letters,
+			phonetic: phoneticKey(letters),
+		})
+	}
+	if len(terms) == 0 || threshold <= 0 {
+		return words, 0
+	}
+
+	speakers := make(map[string][]int)
+	for i, word := range words {
+		speakers[word.Nickname] = append(speakers[word.Nickname], i)
+	}
+	removed := make([]bool, len(words))
+	replacements := 0
+	for _, indices := range speakers {
+		for start := 0; start < len(indices); start++ {
+			term, length, suffix := bestGlossaryMatch(words, indices[start:], terms, threshold)
+			if length == 0 {
+				continue
+			}
+			first, last := &words[indices[start]], words[indices[start+length-1]]
+			first.Text = term.text + inflectionSuffix(last.Text, suffix) + trailingPunctuation(last.Text)
+			first.EndTime = max(first.EndTime, last.EndTime)
+			for _, i := range indices[start+1 : start+length] {
+				removed[i] = true
+			}
+			replacements++
+			start += length - 1
+		}
+	}
+
+	corrected := make([]Word, 0, len(words))
+	for i, word := range words {
+		if !removed[i] {
+			corrected = append(corrected, word)
+		}
+	}
+	return corrected, replacements
+}
+
+// bestGlossaryMatch returns the term that matches the beginning of the words the best together with the amount of matched words
+// and the amount of letters of the inflection suffix of the last word that are not part of the match.
+// If no term reaches the threshold or the words already equal a term (with any suffix) the length is 0.
+// On equal similarity the shorter sequence of words wins so no correctly transcribed words are swallowed.
+func bestGlossaryMatch(words []Word, indices []int, terms []glossaryTerm, threshold float64) (glossaryTerm, int, int) {
+	var best glossaryTerm
+	bestLength, bestSuffix, bestScore := 0, 0, float64(0)
+	for _, term := range terms {
+		phrase := ""
+		for length := 1; length <= term.words+glossaryExtraWords && length <= len(indices); length++ {
+			phrase += lettersOnly(words[indices[length-1]].Text)
+			if length == term.words && strings.HasPrefix(phrase, term.letters) {
+				// already correct, maybe with an inflection like Xanathar's or Waterdeeps
+				return glossaryTerm{}, 0, 0
+			}
+			score, suffix := glossaryScore(phrase, term)
+			if score >= threshold && (score > bestScore || (score == bestScore && length < bestLength)) {
+				best, bestLength, bestSuffix, bestScore = term, length, suffix, score
+			}
+		}
+	}
+	return best, bestLength, bestSuffix
+}
+
+// glossaryScore returns the similarity of the phrase to the term and the amount of letters at the end of the phrase
+// that are an inflection suffix and not part of the term. The suffix with the best similarity wins, on equal similarity the shorter one.
+func glossaryScore(phrase string, term glossaryTerm) (float64, int) {
+	letters := []rune(phrase)
+	bestScore, bestSuffix := float64(0), 0
+	for suffix := 0; suffix <= glossaryMaxSuffix && len(letters)-suffix >= glossaryMinLength; suffix++ {
+		stem := string(letters[:len(letters)-suffix])
+		key := phoneticKey(stem)
+		// the first sound has to match, otherwise preceding words like "in" are swallowed by the term
+		if key[0] != term.phonetic[0] {
+			break
+		}
+		score := max(similarity(stem, term.letters), similarity(key, term.phonetic))
+		if score > bestScore {
+			bestScore, bestSuffix = score, suffix
+		}
+	}
+	return bestScore, bestSuffix
+}
+
+// similarity is 1 minus the Levenshtein distance of a and b relative to the length of the longer string.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current := row[j]
+			row[j] = min(row[j]+1, row[j-1]+1, prev+cost)
+			prev = current
+		}
+	}
+	return row[len(b)]
+}
+
+// lettersOnly returns the lowercase letters of the text without any spaces or punctuation.
+func lettersOnly(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// phoneticReplacer maps letter combinations that sound alike to the same letters.
+var phoneticReplacer = strings.NewReplacer(
+	"ph", "f", "th", "t", "ck", "k", "qu", "kw", "ch", "k", "sh", "s", "dt", "t",
+	"ce", "se", "ci", "si", "cy", "si", "c", "k", "z", "s", "y", "i", "v", "f", "w", "f",
+	"ä", "e", "ö", "o", "ü", "u", "ß", "s",
+)
+
+// phoneticKey creates a rough phonetic representation of lowercase letters so that names that sound alike get similar keys.
+func phoneticKey(letters string) string {
+	if strings.HasPrefix(letters, "x") {
+		// a leading x is usually pronounced like a z, e.g. Xanathar
+		letters = "s" + letters[1:]
+	}
+	letters = phoneticReplacer.Replace(letters)
+	var sb strings.Builder
+	var last rune
+	for _, r := range letters {
+		if r == last {
+			continue
+		}
+		sb.WriteRune(r)
+		last = r
+	}
+	return sb.String()
+}
+
+// inflectionSuffix returns the end of the word that contains the last letters letters (ignoring trailing punctuation),
+// including an apostrophe in front of them like in Xanathar's.
+func inflectionSuffix(word string, letters int) string {
+	if letters == 0 {
+		return ""
+	}
+	trimmed := []rune(strings.TrimRightFunc(word, unicode.IsPunct))
+	i := len(trimmed)
+	for count := 0; i > 0 && count < letters; i-- {
+		if r := trimmed[i-1]; unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+		}
+	}
+	if i > 0 && (trimmed[i-1] == '\'' || trimmed[i-1] == '’') {
+		i--
+	}
+	return string(trimmed[i:])
+}
+
+// trailingPunctuation returns the punctuation at the end of the word.
+func trailingPunctuation(word string) string {
+	trimmed := strings.TrimRightFunc(word, unicode.IsPunct)
+	return word[len(trimmed):]
+}
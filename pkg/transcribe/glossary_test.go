@@ -0,0 +1,36 @@
+package transcribe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyGlossary(t *testing.T) {
+	glossary := []string{"Xanathar", "Waterdeep", "Neverwinter"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Xanathar's lair", want: "Xanathar's lair"},
+		{text: "in Waterdeeps Hafen", want: "in Waterdeeps Hafen"},
+		{text: "Xanathar.", want: "Xanathar."},
+		{text: "Zanna tar is here", want: "Xanathar is here"},
+		{text: "Zanna tar's lair", want: "Xanathar's lair"},
+		{text: "we go to Water deep.", want: "we go to Waterdeep."},
+		{text: "in Water deeps Hafen", want: "in Waterdeeps Hafen"},
+		{text: "Never winter", want: "Neverwinter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			words := make([]Word, 0)
+			for i, text := range strings.Fields(tt.text) {
+				words = append(words, Word{Nickname: "A", Text: text, StartTime: float64(i)})
+			}
+			corrected, _ := ApplyGlossary(words, glossary, 0.8)
+			got := (&Line{Words: corrected}).WordsString()
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
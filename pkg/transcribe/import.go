@@ -0,0 +1,210 @@
+package transcribe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// textWordDuration is the arbitrary duration of each word in formats without timestamps.
+const textWordDuration = 0.2
+
+var (
+	// cueTimingPattern matches the timing line of SRT and WebVTT cues, e.g. 00:01:02,500 --> 00:01:04,000
+	cueTimingPattern = regexp.MustCompile(`^((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})\s+-->\s+((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})`)
+	// voiceTagPattern matches the WebVTT voice tag, e.g. <v Darell> or <v.loud Darell>
+	voiceTagPattern = regexp.MustCompile(`<v(?:\.[^\s>]+)*\s+([^>]+)>`)
+	// tagPattern matches the WebVTT and SRT formatting tags and WebVTT cue timestamps, so other text in angle brackets is kept.
+	tagPattern = regexp.MustCompile(`</?(?:[biu]|c|v|lang|ruby|rt|font)(?:[\s.][^>]*)?>|<\d+(?::\d+)+\.\d+>`)
+	// markdownLinePattern matches a line of the Markdown export, e.g. **[00:01:02] Darell:** text
+	markdownLinePattern = regexp.MustCompile(`^\*\*\[(\d+:\d{2}:\d{2})\]\s+(.+?):\*\*\s*(.*)$`)
+)
+
+// LinesFromFile can be used to read all transcription lines from an input file.
+//
+// The format is detected by the file extension (see Formats) or by the content of the file if the extension is unknown.
+// SRT, WebVTT, JSON and Markdown transcripts keep their timestamps. The timestamps of words within a subtitle cue are
+// evenly distributed over the duration of the cue.
+// For plain text files in the "Nickname: text" format the Word.StartTime will just be arbitrarily increased by 0.2 for each word.
+func LinesFromFile(file string) ([]Line, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	if !slices.Contains(Formats, format) {
+		format = detectFormat(content)
+	}
+	switch format {
+	case FormatSRT, FormatVTT:
+		return linesFromCues(string(content))
+	case FormatJSON:
+		var transcript JSONTranscript
+		if err := json.Unmarshal(content, &transcript); err != nil {
+			return nil, fmt.Errorf("invalid JSON transcript: %w", err)
+		}
+		return transcript.Lines, nil
+	case FormatMarkdown:
+		return linesFromMarkdown(string(content))
+	default:
+		return linesFromText(string(content))
+	}
+}
+
+// detectFormat guesses the transcript format by the content.
+func detectFormat(content []byte) string {
+	trimmed := bytes.TrimSpace(content)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("WEBVTT")):
+		return FormatVTT
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatJSON
+	case bytes.HasPrefix(trimmed, []byte("# ")), bytes.HasPrefix(trimmed, []byte("**[")):
+		return FormatMarkdown
+	}
+	for _, line := range splitLines(string(trimmed)) {
+		if cueTimingPattern.MatchString(strings.TrimSpace(line)) {
+			return FormatSRT
+		}
+	}
+	return FormatText
+}
+
+func splitLines(content string) []string {
+	return strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+}
+
+func linesFromText(content string) ([]Line, error) {
+	readLines := splitLines(content)
+	readLines = slices.DeleteFunc(readLines, func(line string) bool {
+		return strings.TrimSpace(line) == ""
+	})
+
+	lines := make([]Line, len(readLines))
+	currentTimestamp := float64(0)
+	for i, line := range readLines {
+		colonPos := strings.Index(line, ": ")
+		if colonPos <= 0 {
+			return nil, fmt.Errorf("invalid line %d in transcription file, no 'Nickname: ' found", i)
+		}
+		nickname := line[0:colonPos]
+		lines[i] = timedLine(nickname, line[colonPos+2:], currentTimestamp, -1)
+		currentTimestamp += float64(len(lines[i].Words)) * textWordDuration
+	}
+	return lines, nil
+}
+
+// linesFromCues reads SRT or WebVTT subtitles. The nickname is taken from the voice tag or from a "Nickname: " prefix.
+// Consecutive cues of the same speaker stay separate lines. Formatting tags are removed and character references like &amp; are unescaped.
+func linesFromCues(content string) ([]Line, error) {
+	lines := make([]Line, 0)
+	blocks := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n")
+	for _, block := range blocks {
+		blockLines := strings.Split(strings.TrimSpace(block), "\n")
+		timing := slices.IndexFunc(blockLines, func(line string) bool {
+			return cueTimingPattern.MatchString(strings.TrimSpace(line))
+		})
+		if timing < 0 {
+			// header, NOTE, STYLE or REGION blocks
+			continue
+		}
+		match := cueTimingPattern.FindStringSubmatch(strings.TrimSpace(blockLines[timing]))
+		start, err := parseTimestamp(match[1])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimestamp(match[2])
+		if err != nil {
+			return nil, err
+		}
+		text := strings.Join(blockLines[timing+1:], " ")
+		nickname := ""
+		if voice := voiceTagPattern.FindStringSubmatch(text); voice != nil {
+			nickname = html.UnescapeString(strings.TrimSpace(voice[1]))
+		}
+		text = html.UnescapeString(strings.TrimSpace(tagPattern.ReplaceAllString(text, "")))
+		if nickname == "" {
+			if colonPos := strings.Index(text, ": "); colonPos > 0 {
+				nickname = text[:colonPos]
+				text = text[colonPos+2:]
+			} else {
+				nickname = "Unknown"
+			}
+		}
+		if line := timedLine(nickname, text, start, end); len(line.Words) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("no subtitle cues found in transcription file")
+	}
+	return lines, nil
+}
+
+// linesFromMarkdown reads the format written by Export with FormatMarkdown.
+func linesFromMarkdown(content string) ([]Line, error) {
+	lines := make([]Line, 0)
+	for i, line := range splitLines(content) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := markdownLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("invalid line %d in transcription file, no '**[hh:mm:ss] Nickname:**' found", i)
+		}
+		start, err := parseTimestamp(match[1] + ".000")
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, timedLine(match[2], match[3], start, -1))
+	}
+	return lines, nil
+}
+
+// timedLine splits the text into words that are evenly distributed between start and end.
+// If end is negative each word just takes textWordDuration.
+func timedLine(nickname, text string, start, end float64) Line {
+	texts := strings.Fields(text)
+	l := Line{
+		Nickname: nickname,
+		Words:    make([]Word, len(texts)),
+	}
+	step := textWordDuration
+	if end >= start && len(texts) > 0 {
+		step = (end - start) / float64(len(texts))
+	}
+	for i, text := range texts {
+		l.Words[i] = Word{
+			Nickname:  nickname,
+			Text:      text,
+			StartTime: start + float64(i)*step,
+			EndTime:   start + float64(i+1)*step,
+		}
+	}
+	return l
+}
+
+// parseTimestamp parses timestamps like hh:mm:ss,mmm or mm:ss.mmm to seconds.
+func parseTimestamp(timestamp string) (float64, error) {
+	timestamp = strings.Replace(timestamp, ",", ".", 1)
+	parts := strings.Split(timestamp, ":")
+	seconds := float64(0)
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q: %w", timestamp, err)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
@@ -0,0 +1,149 @@
+package transcribe
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testLines creates lines of the "Nickname: text" strings with words that start every startStep seconds.
+func testLines(startStep float64, texts ...string) []Line {
+	lines := make([]Line, 0, len(texts))
+	start := 1.25
+	for _, text := range texts {
+		nickname, words, _ := strings.Cut(text, ": ")
+		line := Line{Nickname: nickname}
+		for _, word := range strings.Fields(words) {
+			line.Words = append(line.Words, Word{Nickname: nickname, Text: word, StartTime: start, EndTime: start + startStep/2})
+			start += startStep
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	lines := testLines(0.75,
+		"GameMaster: You enter the tavern. The bard stops playing.",
+		"Jörg der Zwerg: I order an ale, obviously!",
+		"GameMaster: The innkeeper says: that will be 2 copper.",
+		"Vex: <whispers> I check the room for traps",
+	)
+	tests := []struct {
+		format string
+		// tolerance of the start times in seconds
+		tolerance float64
+	}{
+		{format: FormatSRT, tolerance: 0.001},
+		{format: FormatVTT, tolerance: 0.001},
+		{format: FormatJSON, tolerance: 0},
+		// Markdown timestamps omit the milliseconds
+		{format: FormatMarkdown, tolerance: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dir := t.TempDir()
+			filename, err := ExportFile(dir, tt.format, lines)
+			if err != nil {
+				t.Fatal(err)
+			}
+			imported, err := LinesFromFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertLines(t, imported, lines, tt.tolerance)
+
+			// the format must also be detected without the file extension
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unknown := filepath.Join(dir, "transcript")
+			if err := os.WriteFile(unknown, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if imported, err = LinesFromFile(unknown); err != nil {
+				t.Fatal(err)
+			}
+			assertLines(t, imported, lines, tt.tolerance)
+		})
+	}
+}
+
+func assertLines(t *testing.T, got, want []Line, tolerance float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Nickname != want[i].Nickname {
+			t.Errorf("line %d has nickname %q, want %q", i, got[i].Nickname, want[i].Nickname)
+		}
+		if got[i].WordsString() != want[i].WordsString() {
+			t.Errorf("line %d has text %q, want %q", i, got[i].WordsString(), want[i].WordsString())
+		}
+		if diff := math.Abs(got[i].Start() - want[i].Start()); diff > tolerance {
+			t.Errorf("line %d starts at %v, want %v", i, got[i].Start(), want[i].Start())
+		}
+	}
+}
+
+func TestLinesFromCues(t *testing.T) {
+	vtt := `WEBVTT
+
+NOTE recorded with Craig
+
+1
+00:00:01.000 --> 00:00:03.000
+<v.loud Darell>I <i>attack</i> the <00:00:02.000>goblin!</v>
+
+00:00:03.500 --> 00:00:04.000
+<v GameMaster>Roll &lt;d20&gt; &amp; add your bonus
+
+00:00:05,000 --> 00:00:06,000
+Vex: <whispers> no
+
+00:00:07.000 --> 00:00:08.000
+hello?
+`
+	want := testLines(0, "Darell: I attack the goblin!", "GameMaster: Roll <d20> & add your bonus", "Vex: <whispers> no", "Unknown: hello?")
+	for i, start := range []float64{1, 3.5, 5, 7} {
+		want[i].Words[0].StartTime = start
+	}
+	lines, err := linesFromCues(vtt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLines(t, lines, want, 0.001)
+	if end := lines[0].Words[len(lines[0].Words)-1].EndTime; end != 3 {
+		t.Errorf("last word of the first cue ends at %v, want 3", end)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		timestamp string
+		want      float64
+		wantErr   bool
+	}{
+		{timestamp: "00:00:00,000", want: 0},
+		{timestamp: "00:01:02,500", want: 62.5},
+		{timestamp: "01:02:03.004", want: 3723.004},
+		{timestamp: "02:03.5", want: 123.5},
+		{timestamp: "123:00:00.000", want: 442800},
+		{timestamp: "00:xx:00,000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timestamp, func(t *testing.T) {
+			got, err := parseTimestamp(tt.timestamp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package transcribe
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NicknameRules normalize the nicknames of words so that all tracks of one person end up under the same nickname,
+// e.g. when Craig creates the tracks 1-myuser-0 and 1-myuser-1 because someone reconnected.
+type NicknameRules struct {
+	// Strip contains patterns whose matches are removed from every nickname.
+	Strip []*regexp.Regexp
+	// Aliases maps nicknames to the nickname that should be used instead.
+	// Aliases are matched against the original nickname first and the stripped nickname afterwards.
+	Aliases map[string]string
+}
+
+// NewNicknameRules compiles the strip patterns and creates new NicknameRules.
+func NewNicknameRules(strip []string, aliases map[string]string) (*NicknameRules, error) {
+	rules := &NicknameRules{
+		Strip:   make([]*regexp.Regexp, len(strip)),
+		Aliases: aliases,
+	}
+	for i, pattern := range strip {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nickname strip pattern %q: %w", pattern, err)
+		}
+		rules.Strip[i] = re
+	}
+	return rules, nil
+}
+
+// Normalize returns the nickname after applying all rules.
+// If stripping would remove the entire nickname the original nickname is kept.
+func (r *NicknameRules) Normalize(nickname string) string {
+	if alias, ok := r.Aliases[nickname]; ok && alias != "" {
+		return alias
+	}
+	stripped := nickname
+	for _, re := range r.Strip {
+		stripped = re.ReplaceAllString(stripped, "")
+	}
+	stripped = strings.TrimSpace(stripped)
+	if stripped == "" {
+		stripped = nickname
+	}
+	if alias, ok := r.Aliases[stripped]; ok && alias != "" {
+		return alias
+	}
+	return stripped
+}
+
+// Apply normalizes the nicknames of all words.
+func (r *NicknameRules) Apply(words []Word) {
+	normalized := make(map[string]string)
+	for i, word := range words {
+		nickname, ok := normalized[word.Nickname]
+		if !ok {
+			nickname = r.Normalize(word.Nickname)
+			normalized[word.Nickname] = nickname
+		}
+		words[i].Nickname = nickname
+	}
+}
@@ -0,0 +1,202 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OffsetFileSuffix is appended to the filename of an audio track to get the name of its offset sidecar file,
+// e.g. Darell.flac.offset. The sidecar file contains just the offset of the track as described in ParseOffset.
+const OffsetFileSuffix = ".offset"
+
+const (
+	// envelopeSampleRate is the sample rate used when decoding audio to detect offsets.
+	envelopeSampleRate = 8000
+	// envelopeFrame is the amount of samples that form one frame of the energy envelope (10ms).
+	envelopeFrame = envelopeSampleRate / 100
+)
+
+// ParseOffset parses a track offset that is either a duration like 1m30s or a floating-point amount of seconds like 90.5.
+func ParseOffset(offset string) (float64, error) {
+	offset = strings.TrimSpace(offset)
+	if d, err := time.ParseDuration(offset); err == nil {
+		return d.Seconds(), nil
+	}
+	seconds, err := strconv.ParseFloat(offset, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q, must be a duration like 1m30s or seconds like 90.5", offset)
+	}
+	return seconds, nil
+}
+
+// readOffsetSidecar returns the offset of the sidecar file of the audio file.
+// If there is no sidecar file ok is false.
+func readOffsetSidecar(filename string) (offset float64, ok bool, err error) {
+	content, err := os.ReadFile(filename + OffsetFileSuffix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	offset, err = ParseOffset(string(content))
+	return offset, err == nil, err
+}
+
+// applyOffsets sets the AudioFile.Offset of all files.
+// Offsets are taken from the sidecar files first and from the offsets map (by file stem or nickname) afterwards.
+// If detect is true the offsets of all files that are not explicitly configured are detected by cross-correlating
+// the first window of each track with the first track. They are shifted so they match the first explicitly configured offset.
+func applyOffsets(ctx context.Context, files []AudioFile, offsets map[string]float64, detect bool, window time.Duration) error {
+	explicit := make([]bool, len(files))
+	for i, file := range files {
+		offset, ok, err := readOffsetSidecar(file.Filename)
+		if err != nil {
+			return fmt.Errorf("could not read offset of %q: %w", file.Filename, err)
+		}
+		if !ok {
+			offset, ok = trackSetting(offsets, file)
+		}
+		files[i].Offset = offset
+		explicit[i] = ok
+	}
+	if !detect || len(files) < 2 || !slices.Contains(explicit, false) {
+		return nil
+	}
+	detected, err := DetectOffsets(ctx, files, window)
+	if err != nil {
+		return fmt.Errorf("could not detect offsets: %w", err)
+	}
+	anchorOffsets(files, explicit, detected)
+	return nil
+}
+
+// anchorOffsets sets the detected offsets of all files without an explicit offset.
+// The detected offsets are only relative to each other, so they are shifted to match the first track with an explicit offset.
+func anchorOffsets(files []AudioFile, explicit []bool, detected []float64) {
+	shift := 0.0
+	if anchor := slices.Index(explicit, true); anchor >= 0 {
+		shift = files[anchor].Offset - detected[anchor]
+	}
+	for i := range files {
+		if !explicit[i] {
+			files[i].Offset = detected[i] + shift
+		}
+	}
+}
+
+// DetectOffsets estimates the start offsets of all audio files in seconds relative to each other.
+// This works by cross-correlating the loudness of the first window of each track with the first track,
+// so all tracks need to contain a shared audio cue (like a clap or a countdown) within the window.
+// The smallest returned offset is always 0. Decoding requires ffmpeg to be installed and in PATH.
+func DetectOffsets(ctx context.Context, files []AudioFile, window time.Duration) ([]float64, error) {
+	offsets := make([]float64, len(files))
+	if len(files) == 0 {
+		return offsets, nil
+	}
+	reference, err := loudnessEnvelope(ctx, files[0].Filename, window)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %q: %w", files[0].Filename, err)
+	}
+	maxLag := len(reference) / 2
+	for i, file := range files[1:] {
+		envelope, err := loudnessEnvelope(ctx, file.Filename, window)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %q: %w", file.Filename, err)
+		}
+		lag := bestLag(reference, envelope, maxLag)
+		offsets[i+1] = float64(lag*envelopeFrame) / envelopeSampleRate
+	}
+	minOffset := offsets[0]
+	for _, offset := range offsets {
+		minOffset = min(minOffset, offset)
+	}
+	for i := range offsets {
+		offsets[i] -= minOffset
+	}
+	return offsets, nil
+}
+
+// loudnessEnvelope decodes the first window of the audio file and returns the normalized RMS energy of each frame.
+func loudnessEnvelope(ctx context.Context, filename string, window time.Duration) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error", "-t", strconv.FormatFloat(window.Seconds(), 'f', 3, 64), "-i", filename,
+		"-ac", "1", "-ar", strconv.Itoa(envelopeSampleRate), "-f", "s16le", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("could not run %s, output: %s", cmd, stderr.String()))
+	}
+	samples := make([]int16, len(out)/2)
+	if err := binary.Read(bytes.NewReader(out[:len(samples)*2]), binary.LittleEndian, samples); err != nil {
+		return nil, err
+	}
+	envelope := make([]float64, len(samples)/envelopeFrame)
+	for i := range envelope {
+		sum := float64(0)
+		for _, sample := range samples[i*envelopeFrame : (i+1)*envelopeFrame] {
+			sum += float64(sample) * float64(sample)
+		}
+		envelope[i] = math.Sqrt(sum / envelopeFrame)
+	}
+	normalize(envelope)
+	return envelope, nil
+}
+
+// normalize the values to a mean of 0 and a standard deviation of 1.
+func normalize(values []float64) {
+	if len(values) == 0 {
+		return
+	}
+	mean := float64(0)
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	variance := float64(0)
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(values)))
+	if stdDev == 0 {
+		stdDev = 1
+	}
+	for i, v := range values {
+		values[i] = (v - mean) / stdDev
+	}
+}
+
+// bestLag returns the lag in frames by which the track started later than the reference.
+// It is the lag that maximizes the cross-correlation of reference[i+lag] and track[i].
+func bestLag(reference, track []float64, maxLag int) int {
+	bestLag, bestCorr := 0, math.Inf(-1)
+	for lag := -maxLag; lag <= maxLag; lag++ {
+		sum, n := float64(0), 0
+		for i, v := range track {
+			j := i + lag
+			if j < 0 || j >= len(reference) {
+				continue
+			}
+			sum += reference[j] * v
+			n++
+		}
+		// require a minimum overlap so that tiny overlaps at the edges don't win by chance
+		if n < len(reference)/4 {
+			continue
+		}
+		if corr := sum / float64(n); corr > bestCorr {
+			bestLag, bestCorr = lag, corr
+		}
+	}
+	return bestLag
+}
@@ -0,0 +1,119 @@
+package transcribe
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBestLag(t *testing.T) {
+	// a noisy envelope with a few loud cues like claps or laughter
+	rng := rand.New(rand.NewSource(1))
+	session := make([]float64, 1000)
+	for i := range session {
+		session[i] = rng.Float64()
+	}
+	for _, cue := range []int{120, 340, 610, 870} {
+		session[cue] += 20
+	}
+	normalize(session)
+
+	const length = 500
+	reference := session[200 : 200+length]
+	tests := []struct {
+		name string
+		// start of the track in the session, the reference starts at 200
+		start   int
+		wantLag int
+	}{
+		{name: "same start", start: 200, wantLag: 0},
+		{name: "track started later", start: 237, wantLag: 37},
+		{name: "track started earlier", start: 175, wantLag: -25},
+		{name: "maximum lag", start: 450, wantLag: 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := session[tt.start : tt.start+length]
+			if got := bestLag(reference, track, length/2); got != tt.wantLag {
+				t.Errorf("got lag %d, want %d", got, tt.wantLag)
+			}
+		})
+	}
+}
+
+func TestAnchorOffsets(t *testing.T) {
+	tests := []struct {
+		name     string
+		offsets  []float64
+		explicit []bool
+		detected []float64
+		want     []float64
+	}{
+		{
+			name:     "no explicit offsets",
+			offsets:  []float64{0, 0, 0},
+			explicit: []bool{false, false, false},
+			detected: []float64{0, 1.5, 3},
+			want:     []float64{0, 1.5, 3},
+		},
+		{
+			name:     "first track explicit",
+			offsets:  []float64{10, 0, 0},
+			explicit: []bool{true, false, false},
+			detected: []float64{0, 1.5, 3},
+			want:     []float64{10, 11.5, 13},
+		},
+		{
+			name:     "later track explicit",
+			offsets:  []float64{0, 0, 20},
+			explicit: []bool{false, false, true},
+			detected: []float64{0, 1.5, 3},
+			want:     []float64{17, 18.5, 20},
+		},
+		{
+			name:     "several explicit tracks keep their offsets",
+			offsets:  []float64{0, 5, 100},
+			explicit: []bool{false, true, true},
+			detected: []float64{2, 0, 1},
+			want:     []float64{7, 5, 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make([]AudioFile, len(tt.offsets))
+			for i, offset := range tt.offsets {
+				files[i].Offset = offset
+			}
+			anchorOffsets(files, tt.explicit, tt.detected)
+			got := make([]float64, len(files))
+			for i, file := range files {
+				got[i] = file.Offset
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got offsets %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOffsetsAllExplicit(t *testing.T) {
+	dir := t.TempDir()
+	files := []AudioFile{
+		{Filename: filepath.Join(dir, "1-gmuser.flac"), Nickname: "GameMaster"},
+		{Filename: filepath.Join(dir, "2-myuser.flac"), Nickname: "Darell"},
+	}
+	if err := os.WriteFile(files[1].Filename+OffsetFileSuffix, []byte("1m30s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the audio files do not exist, so detecting the offsets would fail
+	if err := applyOffsets(context.Background(), files, map[string]float64{"GameMaster": 2.5}, true, time.Minute); err != nil {
+		t.Fatalf("offsets were detected although all are explicit: %v", err)
+	}
+	if files[0].Offset != 2.5 || files[1].Offset != 90 {
+		t.Errorf("got offsets %v and %v, want 2.5 and 90", files[0].Offset, files[1].Offset)
+	}
+}
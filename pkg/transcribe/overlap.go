@@ -0,0 +1,88 @@
+package transcribe
+
+// mergeOverlaps splits the words into lines like ToLines, but words of other speakers that overlap the current line
+// don't interrupt it. Another speaker only takes over if they talk during a pause of the current speaker
+// that lasts at least LineOptions.TakeoverPause.
+func mergeOverlaps(words []Word, opts LineOptions) []Line {
+	takeoverPause := opts.TakeoverPause
+	if takeoverPause <= 0 {
+		takeoverPause = defaultTakeoverPause
+	}
+	speakers := make([]string, 0)
+	queues := make(map[string][]Word)
+	for _, word := range words {
+		if _, ok := queues[word.Nickname]; !ok {
+			speakers = append(speakers, word.Nickname)
+		}
+		queues[word.Nickname] = append(queues[word.Nickname], word)
+	}
+
+	lines := make([]Line, 0)
+	for {
+		// the speaker with the earliest pending word starts the next line
+		speaker := ""
+		for _, nickname := range speakers {
+			if len(queues[nickname]) > 0 && (speaker == "" || queues[nickname][0].StartTime < queues[speaker][0].StartTime) {
+				speaker = nickname
+			}
+		}
+		if speaker == "" {
+			return lines
+		}
+		line := []Word{queues[speaker][0]}
+		queues[speaker] = queues[speaker][1:]
+		for len(queues[speaker]) > 0 {
+			next := queues[speaker][0]
+			lastEnd := wordEnd(line[len(line)-1])
+			if !opts.continues(line, next) || (next.StartTime-lastEnd >= takeoverPause.Seconds() && takesOver(queues, speaker, lastEnd, next.StartTime)) {
+				break
+			}
+			line = append(line, next)
+			queues[speaker] = queues[speaker][1:]
+			lines, line = opts.limit(lines, line)
+		}
+		lines = append(lines, asLine(line))
+	}
+}
+
+// takesOver returns true if another speaker than current says a word within the pause between lastEnd and nextStart of the current speaker.
+// Words that overlap the words of the current speaker are crosstalk and don't count.
+// mergeOverlaps only checks pauses of at least LineOptions.TakeoverPause, so short remarks within a running utterance wait in the queue.
+func takesOver(queues map[string][]Word, current string, lastEnd, nextStart float64) bool {
+	for nickname, queue := range queues {
+		if nickname == current {
+			continue
+		}
+		for _, word := range queue {
+			if word.StartTime >= nextStart {
+				break
+			}
+			if word.StartTime >= lastEnd && wordEnd(word) <= nextStart {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// annotateOverlaps marks all lines that start before the previous line of another speaker ended.
+// Lines with at most maxInterjectionWords words are marked as Line.Interjection, longer ones set Line.Interrupts.
+func annotateOverlaps(lines []Line, maxInterjectionWords int) {
+	for i := range lines {
+		line := &lines[i]
+		// the line that was interrupted is the last line of another speaker that is no interjection itself
+		j := i - 1
+		for j >= 0 && (lines[j].Nickname == line.Nickname || lines[j].Interjection) {
+			j--
+		}
+		if j < 0 || line.Start() >= lines[j].End() {
+			continue
+		}
+		previous := lines[j]
+		if len(line.Words) <= maxInterjectionWords {
+			line.Interjection = true
+		} else {
+			line.Interrupts = previous.Nickname
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package transcribe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToLinesMergeOverlaps(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []Word
+		want  []string
+	}{
+		{
+			name: "crosstalk within a running utterance",
+			words: []Word{
+				{Nickname: "A", Text: "I", StartTime: 0, EndTime: 0.3},
+				{Nickname: "B", Text: "no", StartTime: 0.35, EndTime: 0.5},
+				{Nickname: "A", Text: "think", StartTime: 0.55, EndTime: 0.9},
+				{Nickname: "B", Text: "wait", StartTime: 0.95, EndTime: 1.1},
+				{Nickname: "A", Text: "we", StartTime: 1.15, EndTime: 1.3},
+				{Nickname: "A", Text: "should", StartTime: 1.35, EndTime: 1.6},
+			},
+			want: []string{"A: I think we should", "B: [interjection] no wait"},
+		},
+		{
+			name: "answer during a long pause",
+			words: []Word{
+				{Nickname: "A", Text: "Ready?", StartTime: 0, EndTime: 0.5},
+				{Nickname: "B", Text: "Yes,", StartTime: 0.8, EndTime: 1},
+				{Nickname: "B", Text: "go", StartTime: 1.1, EndTime: 1.3},
+				{Nickname: "A", Text: "Then", StartTime: 2, EndTime: 2.2},
+				{Nickname: "A", Text: "go", StartTime: 2.3, EndTime: 2.5},
+			},
+			want: []string{"A: Ready?", "B: Yes, go", "A: Then go"},
+		},
+		{
+			name: "interruption",
+			words: []Word{
+				{Nickname: "A", Text: "So", StartTime: 0, EndTime: 0.2},
+				{Nickname: "A", Text: "we", StartTime: 0.3, EndTime: 0.5},
+				{Nickname: "B", Text: "hold", StartTime: 0.4, EndTime: 0.6},
+				{Nickname: "B", Text: "on", StartTime: 0.7, EndTime: 0.8},
+				{Nickname: "B", Text: "a", StartTime: 0.9, EndTime: 1},
+				{Nickname: "B", Text: "second", StartTime: 1.1, EndTime: 1.4},
+			},
+			want: []string{"A: So we", "B: [interrupts A] hold on a second"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := ToLines(tt.words, LineOptions{
+				Gap:                  5 * time.Second,
+				MergeOverlaps:        true,
+				Annotate:             true,
+				MaxInterjectionWords: 3,
+			})
+			got := make([]string, len(lines))
+			for i, line := range lines {
+				got[i] = line.Nickname + ": " + line.Text()
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got lines %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d is %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
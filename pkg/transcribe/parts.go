@@ -0,0 +1,127 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+	"unicode"
+)
+
+// AsWordsOfParts transcribes a session that was recorded in multiple parts, e.g. because of a break or a lost connection.
+// Each part is a directory that is transcribed like in AsWords. The words of each part are shifted by the accumulated length
+// of all previous parts, so they form one continuous session. The tracks of the parts are matched by their nickname.
+// The length of a part is the length of its longest track (including its offset), which is probed for WAV and FLAC files
+// and taken from the end of the last transcribed word for other formats. If the length of a part can not be determined,
+// a warning is logged and the next part starts at the same time.
+func AsWordsOfParts(ctx context.Context, t Transcriber, dirs []string, opts Options) ([]Word, error) {
+	if len(dirs) == 1 {
+		return AsWords(ctx, t, dirs[0], opts)
+	}
+	allWords := make([]Word, 0)
+	errs := make([]error, 0)
+	start := 0.0
+	for i, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("transcription of part %q was not started: %w", dir, err))
+			break
+		}
+		slog.Info("transcribing part of the session", "part", i+1, "of", len(dirs), "dir", dir, "start", time.Duration(start*float64(time.Second)).Round(time.Second))
+		words, length, err := transcribeDir(ctx, t, dir, opts, true)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, word := range words {
+			word.StartTime += start
+			if word.EndTime != 0 {
+				word.EndTime += start
+			}
+			allWords = append(allWords, word)
+		}
+		if length <= 0 && i+1 < len(dirs) {
+			slog.Warn("length of part could not be determined, the next part will overlap it in the transcript", "part", i+1, "dir", dir)
+		}
+		start += length
+	}
+	return allWords, errors.Join(errs...)
+}
+
+// SessionParts returns the directories of all parts of the session recorded in dir.
+// If dir contains audio files of the fileTypes it is the only part. Otherwise every subdirectory that contains audio files is a part,
+// e.g. part1 and part2. The parts are sorted by name with numbers in their natural order, so part10 comes after part9.
+func SessionParts(dir string, fileTypes []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not open directory %q: %w", dir, err)
+	}
+	parts := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if isAudioFile(entry.Name(), fileTypes) {
+				return []string{dir}, nil
+			}
+			continue
+		}
+		subEntries, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not open directory %q: %w", filepath.Join(dir, entry.Name()), err)
+		}
+		if slices.ContainsFunc(subEntries, func(sub os.DirEntry) bool {
+			return !sub.IsDir() && isAudioFile(sub.Name(), fileTypes)
+		}) {
+			parts = append(parts, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(parts) == 0 {
+		return []string{dir}, nil
+	}
+	slices.SortFunc(parts, naturalCompare)
+	return parts, nil
+}
+
+// isAudioFile returns true if the file has one of the fileTypes as extension.
+func isAudioFile(name string, fileTypes []string) bool {
+	ext := filepath.Ext(name)
+	return slices.ContainsFunc(fileTypes, func(desiredExt string) bool {
+		return ext == "."+desiredExt
+	})
+}
+
+// naturalCompare compares the strings like strings.Compare but all numbers within them by their value.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		aChunk, aRest := nextChunk(a)
+		bChunk, bRest := nextChunk(b)
+		aNum, aErr := strconv.Atoi(aChunk)
+		bNum, bErr := strconv.Atoi(bChunk)
+		switch {
+		case aErr == nil && bErr == nil && aNum != bNum:
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		case aChunk < bChunk:
+			return -1
+		case aChunk > bChunk:
+			return 1
+		}
+		a, b = aRest, bRest
+	}
+	return len(a) - len(b)
+}
+
+// nextChunk splits s after its leading run of either digits or non-digits.
+func nextChunk(s string) (chunk, rest string) {
+	digit := unicode.IsDigit(rune(s[0]))
+	for i, r := range s {
+		if unicode.IsDigit(r) != digit {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
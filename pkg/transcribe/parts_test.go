@@ -0,0 +1,135 @@
+package transcribe
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "part2", b: "part10", want: -1},
+		{a: "part10", b: "part9", want: 1},
+		{a: "part1", b: "part1", want: 0},
+		{a: "part01", b: "part1", want: -1},
+		{a: "part1", b: "part1b", want: -1},
+		{a: "2024-05-01 part2", b: "2024-05-01 part10", want: -1},
+		{a: "a", b: "b", want: -1},
+		{a: "part", b: "part1", want: -1},
+		{a: "10", b: "9a", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			got := naturalCompare(tt.a, tt.b)
+			if got < 0 && tt.want >= 0 || got > 0 && tt.want <= 0 || got == 0 && tt.want != 0 {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// createFiles creates empty files and directories (ending with a slash) in dir.
+func createFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionParts(t *testing.T) {
+	fileTypes := []string{"flac", "wav"}
+	tests := []struct {
+		name  string
+		files []string
+		// want are the parts relative to the session directory, "." is the session directory itself.
+		want []string
+	}{
+		{
+			name:  "audio files in the session directory",
+			files: []string{"1-gmuser.flac", "2-myuser.flac", "part1/1-gmuser.flac", "info.txt"},
+			want:  []string{"."},
+		},
+		{
+			name:  "parts in natural order",
+			files: []string{"part10/1-gmuser.flac", "part2/1-gmuser.wav", "part1/1-gmuser.flac", "part1/2-myuser.flac", "info.txt"},
+			want:  []string{"part1", "part2", "part10"},
+		},
+		{
+			name:  "subdirectories without audio files are ignored",
+			files: []string{"part1/1-gmuser.flac", "part2/notes.txt", "part3/nested/1-gmuser.flac", "empty/"},
+			want:  []string{"part1"},
+		},
+		{
+			name:  "no audio files at all",
+			files: []string{"notes.txt", "empty/", "images/map.png"},
+			want:  []string{"."},
+		},
+		{
+			name:  "other file types",
+			files: []string{"part1/1-gmuser.ogg", "part2/1-gmuser.flac"},
+			want:  []string{"part2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createFiles(t, dir, tt.files...)
+			parts, err := SessionParts(dir, fileTypes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]string, len(tt.want))
+			for i, part := range tt.want {
+				want[i] = filepath.Join(dir, part)
+			}
+			if !slices.Equal(parts, want) {
+				t.Errorf("got parts %q, want %q", parts, want)
+			}
+		})
+	}
+
+	if _, err := SessionParts(filepath.Join(t.TempDir(), "missing"), fileTypes); err == nil {
+		t.Error("got no error for a missing directory")
+	}
+}
+
+func TestAsWordsOfParts(t *testing.T) {
+	dir := t.TempDir()
+	spec := wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1}
+	for _, part := range []string{"part1", "part2"} {
+		createFiles(t, dir, part+"/")
+		writeTestWav(t, filepath.Join(dir, part, "gm.wav"), spec, make([]float64, 5*testSampleRate))
+	}
+	stub := &stubTranscriber{durations: make(map[string]time.Duration)}
+	words, err := AsWordsOfParts(context.Background(), stub, []string{filepath.Join(dir, "part1"), filepath.Join(dir, "part2")}, Options{FileTypes: []string{"wav"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := make([]float64, len(words))
+	for i, word := range words {
+		starts[i] = word.StartTime
+	}
+	// the words of the second part are shifted by the length of the first part (5s)
+	if want := []float64{0.5, 2, 3, 5.5, 7, 8}; !slices.Equal(starts, want) {
+		t.Errorf("got words starting at %v, want %v", starts, want)
+	}
+}
@@ -0,0 +1,122 @@
+package transcribe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// preprocessSampleRate is the sample rate of preprocessed audio files, which is the rate that Whisper works with.
+	preprocessSampleRate = 16000
+	// loudnormFilter normalizes the loudness to the EBU R128 recommendation for speech.
+	loudnormFilter = "loudnorm=I=-16:TP=-1.5:LRA=11"
+	// denoiseFilter removes rumble below the human voice and broadband background noise like fans or hissing microphones.
+	denoiseFilter = "highpass=f=80,afftdn=nf=-25"
+)
+
+// PreprocessOptions configure how audio files are converted before they are transcribed.
+type PreprocessOptions struct {
+	// Dir is the directory that the converted files are cached in.
+	Dir string
+	// Loudnorm can be true to normalize the loudness of the audio, which helps with quiet microphones.
+	Loudnorm bool
+	// Denoise can be true to remove background noise.
+	Denoise bool
+}
+
+// filters returns the ffmpeg audio filters for the options.
+func (o PreprocessOptions) filters() []string {
+	filters := make([]string, 0, 2)
+	if o.Denoise {
+		filters = append(filters, denoiseFilter)
+	}
+	if o.Loudnorm {
+		filters = append(filters, loudnormFilter)
+	}
+	return filters
+}
+
+// Preprocess converts the audio file to a 16 kHz mono WAV file and applies the configured filters using ffmpeg.
+// This supports every container and codec of ffmpeg like Ogg, AAC or M4A. Requires ffmpeg to be installed and in PATH.
+// Converted files are cached in PreprocessOptions.Dir by the content of the audio file and the filters.
+// Returns the name of the converted file.
+func Preprocess(ctx context.Context, filename string, opts PreprocessOptions) (string, error) {
+	fileHash, err := hashFile(filename)
+	if err != nil {
+		return "", err
+	}
+	filters := strings.Join(opts.filters(), ",")
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%s", fileHash, preprocessSampleRate, filters)
+	converted := filepath.Join(opts.Dir, hex.EncodeToString(h.Sum(nil))+".wav")
+	if _, err := os.Stat(converted); err == nil {
+		// mark the file as recently used so it will survive pruning
+		now := time.Now()
+		if err := os.Chtimes(converted, now, now); err != nil {
+			slog.Debug("could not update modification time of preprocessed file", "file", converted, "error", err)
+		}
+		return converted, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return "", err
+	}
+	// convert to a temporary file first so parallel or aborted runs never leave a broken file
+	tmpFile, err := os.CreateTemp(opts.Dir, ".tmp-*.wav")
+	if err != nil {
+		return "", err
+	}
+	tmp := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(tmp)
+	args := []string{"-v", "error", "-y", "-i", filename, "-vn", "-ac", "1", "-ar", strconv.Itoa(preprocessSampleRate)}
+	if filters != "" {
+		args = append(args, "-af", filters)
+	}
+	args = append(args, "-c:a", "pcm_s16le", tmp)
+	if err := runProcess(ctx, AudioFile{Filename: filename}, nil, nil, "ffmpeg", args...); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, converted); err != nil {
+		return "", err
+	}
+	return converted, nil
+}
+
+// PreprocessedTranscriber converts every audio file using Preprocess before it is transcribed by its Transcriber.
+type PreprocessedTranscriber struct {
+	// Transcriber that transcribes the converted files.
+	Transcriber interface {
+		Transcriber
+		Fingerprinter
+	}
+	// Options for the conversion.
+	Options PreprocessOptions
+}
+
+// Transcribe the preprocessed audio file. The returned words are not affected by the conversion.
+func (p *PreprocessedTranscriber) Transcribe(ctx context.Context, file AudioFile) ([]Word, error) {
+	converted, err := Preprocess(ctx, file.Filename, p.Options)
+	if err != nil {
+		return nil, fmt.Errorf("could not preprocess audio file: %w", err)
+	}
+	slog.Debug("audio track preprocessed", "file", file.Filename, "preprocessed", converted)
+	file.Filename = converted
+	return p.Transcriber.Transcribe(ctx, file)
+}
+
+// Fingerprint returns the Fingerprint of the wrapped Transcriber together with the preprocessing filters.
+func (p *PreprocessedTranscriber) Fingerprint() string {
+	return p.Transcriber.Fingerprint() + " preprocess=" + strings.Join(p.Options.filters(), ",")
+}
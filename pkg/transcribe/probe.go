@@ -0,0 +1,412 @@
+package transcribe
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+)
+
+const (
+	// probeWindow is the length of the windows whose RMS level is compared with the silence threshold.
+	// It is long enough that single clicks or bumps against the microphone hardly count as sound.
+	probeWindow = 500 * time.Millisecond
+	// wavFormatPCM, wavFormatFloat and wavFormatExtensible are the supported format tags of WAV files.
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+// ErrUnsupportedAudio is returned by ProbeAudio for audio files that can not be decoded without external tools.
+var ErrUnsupportedAudio = errors.New("unsupported audio format, only WAV and FLAC files can be probed")
+
+// AudioInfo describes the content of an audio file.
+type AudioInfo struct {
+	// Duration of the audio file.
+	Duration time.Duration
+	// Level is the RMS level in dBFS of the loudest window that was decoded. Digital silence is -Inf.
+	Level float64
+	// Silent is true if no window of the audio file is louder than the threshold.
+	Silent bool
+}
+
+// ProbeAudio decodes the WAV or FLAC file and returns its duration and whether it is silent.
+// Decoding stops at the first window whose RMS level is above the threshold in dBFS, e.g. -60,
+// so only completely silent files are decoded until the end (unless their duration is not stored in the header).
+// Other formats return ErrUnsupportedAudio. Decoding is aborted when the context is done.
+func ProbeAudio(ctx context.Context, filename string, threshold float64) (AudioInfo, error) {
+	dec, err := openAudio(filename)
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	defer dec.Close()
+
+	info := AudioInfo{Level: math.Inf(-1), Silent: true}
+	minPower := math.Pow(10, threshold/10)
+	window := make([]float64, max(int(float64(dec.SampleRate())*probeWindow.Seconds()), 1))
+	samples := int64(0)
+	for {
+		if err := ctx.Err(); err != nil {
+			return info, err
+		}
+		n, err := readWindow(dec, window)
+		if n > 0 {
+			samples += int64(n)
+			if info.Silent {
+				power := meanSquare(window[:n])
+				info.Level = max(info.Level, 10*math.Log10(power))
+				if power > minPower {
+					info.Silent = false
+					if dec.NSamples() > 0 {
+						// the remaining audio is not needed as the header already contains the duration
+						samples = dec.NSamples()
+						break
+					}
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return info, fmt.Errorf("could not decode %q: %w", filename, err)
+		}
+	}
+	info.Duration = time.Duration(float64(samples) / float64(dec.SampleRate()) * float64(time.Second))
+	return info, nil
+}
+
+// probeTracks probes up to Options.Concurrency files in parallel and logs their duration and the estimated runtime of their transcription.
+// Returns the files without the silent ones if Options.SkipSilent is true together with their durations.
+// Files that can not be probed are always kept with a duration of 0. The error is only set if the context is done.
+func probeTracks(ctx context.Context, files []AudioFile, opts Options) ([]AudioFile, []time.Duration, error) {
+	infos := make([]AudioInfo, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			infos[i], errs[i] = ProbeAudio(ctx, file.Filename, opts.SilenceThreshold)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("probing of audio tracks was aborted: %w", err)
+	}
+
+	kept := make([]AudioFile, 0, len(files))
+	keptDurations := make([]time.Duration, 0, len(files))
+	durations := make([]time.Duration, 0, len(files))
+	for i, file := range files {
+		info, err := infos[i], errs[i]
+		level := math.Round(info.Level*10) / 10
+		switch {
+		case errors.Is(err, ErrUnsupportedAudio):
+			slog.Debug("audio track can not be probed", "file", file.Filename, "error", err)
+		case err != nil:
+			slog.Warn("could not probe audio track", "file", file.Filename, "error", err)
+		case info.Silent && opts.SkipSilent:
+			slog.Info("skipping silent audio track", "file", file.Filename, "nickname", file.Nickname, "duration", info.Duration.Round(time.Second), "level", level)
+			continue
+		default:
+			attrs := []any{"file", file.Filename, "duration", info.Duration.Round(time.Second), "level", level}
+			if opts.RealtimeFactor > 0 {
+				attrs = append(attrs, "estimated-runtime", estimateRuntime([]time.Duration{info.Duration}, 1, opts.RealtimeFactor))
+			}
+			slog.Info("audio track probed", attrs...)
+			durations = append(durations, info.Duration)
+		}
+		kept = append(kept, file)
+		keptDurations = append(keptDurations, info.Duration)
+	}
+	if opts.RealtimeFactor > 0 && len(durations) > 0 {
+		slog.Info("estimated runtime of the transcription", "tracks", len(durations), "runtime", estimateRuntime(durations, opts.Concurrency, opts.RealtimeFactor))
+	}
+	return kept, keptDurations, nil
+}
+
+// estimateRuntime returns how long it takes to transcribe audio tracks of the durations in order
+// when up to concurrency tracks are transcribed in parallel and each is transcribed factor times faster than realtime.
+func estimateRuntime(durations []time.Duration, concurrency int, factor float64) time.Duration {
+	// every slot holds the time at which its current transcription will be done
+	slots := make([]time.Duration, max(concurrency, 1))
+	for _, d := range durations {
+		next := slices.Index(slots, slices.Min(slots))
+		slots[next] += time.Duration(float64(d) / factor)
+	}
+	return slices.Max(slots).Round(time.Second)
+}
+
+// readWindow reads samples from the decoder until the window is full or an error occurs.
+func readWindow(dec audioDecoder, window []float64) (int, error) {
+	n := 0
+	for n < len(window) {
+		read, err := dec.Read(window[n:])
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// meanSquare returns the mean of the squared samples, which is the power of the samples relative to full scale.
+func meanSquare(samples []float64) float64 {
+	sum := 0.0
+	for _, s := range samples {
+		sum += s * s
+	}
+	return sum / float64(len(samples))
+}
+
+// audioDecoder reads the samples of an audio file mixed down to mono and scaled to -1 to 1.
+type audioDecoder interface {
+	// Read decodes up to len(samples) samples. Returns io.EOF at the end of the audio.
+	Read(samples []float64) (int, error)
+	// SampleRate in Hz.
+	SampleRate() int
+	// NSamples is the total amount of samples per channel as stored in the header or 0 if it is unknown.
+	NSamples() int64
+	Close() error
+}
+
+// openAudio returns the decoder for the WAV or FLAC file or ErrUnsupportedAudio.
+func openAudio(filename string) (audioDecoder, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".wav":
+		return openWav(filename)
+	case ".flac":
+		return openFlac(filename)
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+}
+
+// wavDecoder decodes uncompressed PCM or IEEE float WAV files.
+type wavDecoder struct {
+	f          *os.File
+	r          *bufio.Reader
+	format     uint16
+	channels   int
+	sampleRate int
+	// bytesPerSample of a single channel.
+	bytesPerSample int
+	// remaining bytes of the data chunk or -1 if the size of the data chunk is unknown.
+	remaining int64
+	nSamples  int64
+	frame     []byte
+}
+
+func openWav(filename string) (*wavDecoder, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	d := &wavDecoder{f: f, r: bufio.NewReader(f)}
+	if err := d.readHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid WAV file %q: %w", filename, err)
+	}
+	return d, nil
+}
+
+// readHeader reads all chunks up to the start of the audio data.
+func (d *wavDecoder) readHeader() error {
+	var riff [12]byte
+	if _, err := io.ReadFull(d.r, riff[:]); err != nil {
+		return err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return errors.New("missing RIFF/WAVE header")
+	}
+	offset := int64(len(riff))
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(d.r, chunk[:]); err != nil {
+			return fmt.Errorf("missing data chunk: %w", err)
+		}
+		offset += int64(len(chunk))
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch id {
+		case "fmt ":
+			if err := d.readFormat(size); err != nil {
+				return err
+			}
+		case "data":
+			if d.channels == 0 {
+				return errors.New("data chunk before fmt chunk")
+			}
+			frameSize := int64(d.channels * d.bytesPerSample)
+			d.frame = make([]byte, frameSize)
+			d.remaining = size
+			if size == 0 || size == math.MaxUint32 {
+				// the size is not known when the file was written as a stream, so the data lasts until the end of the file
+				d.remaining = -1
+				if stat, err := d.f.Stat(); err == nil {
+					size = stat.Size() - offset
+				}
+			}
+			d.nSamples = size / frameSize
+			return nil
+		default:
+			// chunks are padded to an even size
+			skip := size + size%2
+			if _, err := d.r.Discard(int(skip)); err != nil {
+				return err
+			}
+		}
+		offset += size + size%2
+	}
+}
+
+func (d *wavDecoder) readFormat(size int64) error {
+	if size < 16 {
+		return fmt.Errorf("fmt chunk is too short (%d bytes)", size)
+	}
+	chunk := make([]byte, size+size%2)
+	if _, err := io.ReadFull(d.r, chunk); err != nil {
+		return err
+	}
+	d.format = binary.LittleEndian.Uint16(chunk[0:2])
+	d.channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+	d.sampleRate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+	bitsPerSample := int(binary.LittleEndian.Uint16(chunk[14:16]))
+	if d.format == wavFormatExtensible && size >= 26 {
+		// the actual format is stored in the first two bytes of the sub format GUID
+		d.format = binary.LittleEndian.Uint16(chunk[24:26])
+	}
+	d.bytesPerSample = (bitsPerSample + 7) / 8
+	if d.channels == 0 || d.sampleRate == 0 {
+		return errors.New("invalid amount of channels or sample rate")
+	}
+	switch {
+	case d.format == wavFormatPCM && d.bytesPerSample >= 1 && d.bytesPerSample <= 4:
+	case d.format == wavFormatFloat && (d.bytesPerSample == 4 || d.bytesPerSample == 8):
+	default:
+		return fmt.Errorf("unsupported format %#x with %d bits per sample", d.format, bitsPerSample)
+	}
+	return nil
+}
+
+func (d *wavDecoder) Read(samples []float64) (int, error) {
+	for i := range samples {
+		if d.remaining >= 0 && d.remaining < int64(len(d.frame)) {
+			return i, io.EOF
+		}
+		if _, err := io.ReadFull(d.r, d.frame); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				err = io.EOF
+			}
+			return i, err
+		}
+		if d.remaining >= 0 {
+			d.remaining -= int64(len(d.frame))
+		}
+		sum := 0.0
+		for c := 0; c < d.channels; c++ {
+			sum += d.sample(d.frame[c*d.bytesPerSample : (c+1)*d.bytesPerSample])
+		}
+		samples[i] = sum / float64(d.channels)
+	}
+	return len(samples), nil
+}
+
+// sample converts the little-endian bytes of a single sample to a value between -1 and 1.
+func (d *wavDecoder) sample(b []byte) float64 {
+	if d.format == wavFormatFloat {
+		if len(b) == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	if len(b) == 1 {
+		// 8 bit samples are the only unsigned ones
+		return (float64(b[0]) - 128) / 128
+	}
+	var v int64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | int64(b[i])
+	}
+	bits := uint(len(b) * 8)
+	// sign extend the sample
+	v = v << (64 - bits) >> (64 - bits)
+	return float64(v) / float64(int64(1)<<(bits-1))
+}
+
+func (d *wavDecoder) SampleRate() int { return d.sampleRate }
+
+func (d *wavDecoder) NSamples() int64 { return d.nSamples }
+
+func (d *wavDecoder) Close() error { return d.f.Close() }
+
+// flacDecoder decodes FLAC files.
+type flacDecoder struct {
+	f      *os.File
+	stream *flac.Stream
+	frame  *frame.Frame
+	// pos is the next sample of frame to read.
+	pos   int
+	scale float64
+}
+
+func openFlac(filename string) (*flacDecoder, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// the stream is created from the file instead of flac.Open, as closing such a stream does not close the file
+	stream, err := flac.New(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid FLAC file %q: %w", filename, err)
+	}
+	return &flacDecoder{
+		f:      f,
+		stream: stream,
+		scale:  float64(int64(1) << (stream.Info.BitsPerSample - 1)),
+	}, nil
+}
+
+func (d *flacDecoder) Read(samples []float64) (int, error) {
+	for i := range samples {
+		for d.frame == nil || d.pos >= len(d.frame.Subframes[0].Samples) {
+			f, err := d.stream.ParseNext()
+			if err != nil {
+				return i, err
+			}
+			d.frame = f
+			d.pos = 0
+		}
+		sum := 0.0
+		for _, subframe := range d.frame.Subframes {
+			sum += float64(subframe.Samples[d.pos])
+		}
+		samples[i] = sum / float64(len(d.frame.Subframes)) / d.scale
+		d.pos++
+	}
+	return len(samples), nil
+}
+
+func (d *flacDecoder) SampleRate() int { return int(d.stream.Info.SampleRate) }
+
+func (d *flacDecoder) NSamples() int64 { return int64(d.stream.Info.NSamples) }
+
+func (d *flacDecoder) Close() error { return d.f.Close() }
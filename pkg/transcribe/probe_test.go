@@ -0,0 +1,294 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+const (
+	testSampleRate = 8000
+	testDuration   = 2 * time.Second
+	// testAmplitude of the loud sine, whose level is 20*log10(0.5/sqrt(2)) = -9.03 dBFS.
+	testAmplitude = 0.5
+	testLevel     = -9.03
+)
+
+// testSignal returns the samples of a 440 Hz sine with the amplitude.
+func testSignal(amplitude float64, rate int) []float64 {
+	samples := make([]float64, int(testDuration.Seconds()*float64(rate)))
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*440*float64(i)/float64(rate))
+	}
+	return samples
+}
+
+// wavSpec describes how a test WAV file is written.
+type wavSpec struct {
+	format     uint16
+	bits       int
+	extensible bool
+	// stereo files contain the signal on the left and silence on the right channel.
+	stereo bool
+	// dataSize overrides the size of the data chunk, e.g. 0 or 0xFFFFFFFF for streamed files. -1 writes the actual size.
+	dataSize int64
+	// junk adds a chunk of an odd size between the fmt and the data chunk.
+	junk bool
+}
+
+func writeTestWav(t *testing.T, filename string, spec wavSpec, signal []float64) {
+	t.Helper()
+	channels := 1
+	if spec.stereo {
+		channels = 2
+	}
+	bytesPerSample := spec.bits / 8
+	var data bytes.Buffer
+	for _, s := range signal {
+		for c := range channels {
+			v := s
+			if c > 0 {
+				v = 0
+			}
+			switch {
+			case spec.format == wavFormatFloat && spec.bits == 32:
+				binary.Write(&data, binary.LittleEndian, float32(v))
+			case spec.format == wavFormatFloat:
+				binary.Write(&data, binary.LittleEndian, v)
+			case spec.bits == 8:
+				data.WriteByte(byte(math.Round(v*127) + 128))
+			default:
+				q := int64(math.Round(v * float64(int64(1)<<(spec.bits-1)-1)))
+				for b := range bytesPerSample {
+					data.WriteByte(byte(q >> (8 * b)))
+				}
+			}
+		}
+	}
+
+	var fmtChunk bytes.Buffer
+	format := spec.format
+	if spec.extensible {
+		format = wavFormatExtensible
+	}
+	blockAlign := channels * bytesPerSample
+	for _, v := range []any{format, uint16(channels), uint32(testSampleRate), uint32(testSampleRate * blockAlign), uint16(blockAlign), uint16(spec.bits)} {
+		binary.Write(&fmtChunk, binary.LittleEndian, v)
+	}
+	if spec.extensible {
+		for _, v := range []any{uint16(22), uint16(spec.bits), uint32(0), spec.format} {
+			binary.Write(&fmtChunk, binary.LittleEndian, v)
+		}
+		fmtChunk.WriteString("\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71")
+	}
+
+	var f bytes.Buffer
+	f.WriteString("RIFF")
+	binary.Write(&f, binary.LittleEndian, uint32(0)) // the RIFF size is not checked
+	f.WriteString("WAVEfmt ")
+	binary.Write(&f, binary.LittleEndian, uint32(fmtChunk.Len()))
+	f.Write(fmtChunk.Bytes())
+	if spec.junk {
+		f.WriteString("LIST")
+		binary.Write(&f, binary.LittleEndian, uint32(5))
+		f.WriteString("INFO\x00\x00") // 5 bytes and 1 byte padding
+	}
+	f.WriteString("data")
+	dataSize := uint32(data.Len())
+	if spec.dataSize >= 0 {
+		dataSize = uint32(spec.dataSize)
+	}
+	binary.Write(&f, binary.LittleEndian, dataSize)
+	f.Write(data.Bytes())
+	if err := os.WriteFile(filename, f.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestFlac(t *testing.T, filename string, signal []float64) {
+	t.Helper()
+	const rate, bits, blockSize = 16000, 16, 4096
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc, err := flac.NewEncoder(f, &meta.StreamInfo{
+		BlockSizeMin:  blockSize,
+		BlockSizeMax:  blockSize,
+		SampleRate:    rate,
+		NChannels:     1,
+		BitsPerSample: bits,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for start := 0; start < len(signal); start += blockSize {
+		block := signal[start:min(start+blockSize, len(signal))]
+		samples := make([]int32, len(block))
+		for i, s := range block {
+			samples[i] = int32(math.Round(s * (1<<(bits-1) - 1)))
+		}
+		err := enc.WriteFrame(&frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(len(block)),
+				SampleRate:        rate,
+				Channels:          frame.ChannelsMono,
+				BitsPerSample:     bits,
+			},
+			Subframes: []*frame.Subframe{{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   samples,
+				NSamples:  len(samples),
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProbeAudioWav(t *testing.T) {
+	tests := []struct {
+		name string
+		spec wavSpec
+		// wantLevel of the loud file, the mixdown of stereo files halves the amplitude (-6.02 dB).
+		wantLevel float64
+	}{
+		{name: "8 bit", spec: wavSpec{format: wavFormatPCM, bits: 8, dataSize: -1}, wantLevel: testLevel},
+		{name: "16 bit", spec: wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1}, wantLevel: testLevel},
+		{name: "24 bit", spec: wavSpec{format: wavFormatPCM, bits: 24, dataSize: -1}, wantLevel: testLevel},
+		{name: "32 bit", spec: wavSpec{format: wavFormatPCM, bits: 32, dataSize: -1}, wantLevel: testLevel},
+		{name: "32 bit float", spec: wavSpec{format: wavFormatFloat, bits: 32, dataSize: -1}, wantLevel: testLevel},
+		{name: "64 bit float", spec: wavSpec{format: wavFormatFloat, bits: 64, dataSize: -1}, wantLevel: testLevel},
+		{name: "extensible 24 bit", spec: wavSpec{format: wavFormatPCM, bits: 24, extensible: true, dataSize: -1}, wantLevel: testLevel},
+		{name: "extensible float", spec: wavSpec{format: wavFormatFloat, bits: 32, extensible: true, dataSize: -1}, wantLevel: testLevel},
+		{name: "stereo", spec: wavSpec{format: wavFormatPCM, bits: 16, stereo: true, dataSize: -1}, wantLevel: testLevel - 6.02},
+		{name: "streamed with size 0", spec: wavSpec{format: wavFormatPCM, bits: 16, dataSize: 0}, wantLevel: testLevel},
+		{name: "streamed with size 0xFFFFFFFF", spec: wavSpec{format: wavFormatPCM, bits: 16, dataSize: math.MaxUint32}, wantLevel: testLevel},
+		{name: "chunk of odd size", spec: wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1, junk: true}, wantLevel: testLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			loud, silent := filepath.Join(dir, "loud.wav"), filepath.Join(dir, "silent.wav")
+			writeTestWav(t, loud, tt.spec, testSignal(testAmplitude, testSampleRate))
+			writeTestWav(t, silent, tt.spec, testSignal(0, testSampleRate))
+
+			info, err := ProbeAudio(context.Background(), loud, -60)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Silent || info.Duration != testDuration || math.Abs(info.Level-tt.wantLevel) > 0.1 {
+				t.Errorf("got %+v for the loud file, want a duration of %s and a level of %.2f", info, testDuration, tt.wantLevel)
+			}
+			info, err = ProbeAudio(context.Background(), silent, -60)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Silent || info.Duration != testDuration || !math.IsInf(info.Level, -1) {
+				t.Errorf("got %+v for the silent file, want it to be silent for %s", info, testDuration)
+			}
+		})
+	}
+}
+
+func TestProbeAudioFlac(t *testing.T) {
+	dir := t.TempDir()
+	loud, silent := filepath.Join(dir, "loud.flac"), filepath.Join(dir, "silent.flac")
+	writeTestFlac(t, loud, testSignal(testAmplitude, 16000))
+	writeTestFlac(t, silent, testSignal(0, 16000))
+
+	info, err := ProbeAudio(context.Background(), loud, -60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Silent || info.Duration != testDuration || math.Abs(info.Level-testLevel) > 0.1 {
+		t.Errorf("got %+v for the loud file, want a duration of %s and a level of %.2f", info, testDuration, testLevel)
+	}
+	info, err = ProbeAudio(context.Background(), silent, -60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Silent || info.Duration != testDuration {
+		t.Errorf("got %+v for the silent file, want it to be silent for %s", info, testDuration)
+	}
+}
+
+func TestProbeAudioThreshold(t *testing.T) {
+	// a sine with an amplitude of 0.0005 has a level of -69 dBFS, which is typical for the noise floor of a muted microphone
+	filename := filepath.Join(t.TempDir(), "noise.wav")
+	writeTestWav(t, filename, wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1}, testSignal(0.0005, testSampleRate))
+	for threshold, wantSilent := range map[float64]bool{-60: true, -80: false} {
+		info, err := ProbeAudio(context.Background(), filename, threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Silent != wantSilent || math.Abs(info.Level+69) > 0.5 {
+			t.Errorf("got %+v with a threshold of %v, want silent %t at a level of -69", info, threshold, wantSilent)
+		}
+	}
+}
+
+func TestProbeAudioErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.wav")
+	if err := os.WriteFile(invalid, []byte("RIFF\x00\x00\x00\x00AVI "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProbeAudio(context.Background(), invalid, -60); err == nil {
+		t.Error("probed an invalid WAV file")
+	}
+	if _, err := ProbeAudio(context.Background(), filepath.Join(dir, "track.ogg"), -60); !errors.Is(err, ErrUnsupportedAudio) {
+		t.Errorf("got error %v for an Ogg file, want ErrUnsupportedAudio", err)
+	}
+
+	silent := filepath.Join(dir, "silent.wav")
+	writeTestWav(t, silent, wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1}, testSignal(0, testSampleRate))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ProbeAudio(ctx, silent, -60); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v when the context is canceled, want context.Canceled", err)
+	}
+}
+
+func TestProbeTracks(t *testing.T) {
+	dir := t.TempDir()
+	files := []AudioFile{
+		{Filename: filepath.Join(dir, "1-gmuser.wav"), Nickname: "GameMaster"},
+		{Filename: filepath.Join(dir, "2-muted.wav"), Nickname: "Muted"},
+		{Filename: filepath.Join(dir, "3-myuser.ogg"), Nickname: "Darell"},
+	}
+	spec := wavSpec{format: wavFormatPCM, bits: 16, dataSize: -1}
+	writeTestWav(t, files[0].Filename, spec, testSignal(testAmplitude, testSampleRate))
+	writeTestWav(t, files[1].Filename, spec, testSignal(0, testSampleRate))
+
+	kept, durations, err := probeTracks(context.Background(), files, Options{SkipSilent: true, SilenceThreshold: -60, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(kept, []AudioFile{files[0], files[2]}) || !slices.Equal(durations, []time.Duration{testDuration, 0}) {
+		t.Errorf("kept %v with durations %v, want the loud and the unsupported track", kept, durations)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := probeTracks(ctx, files, Options{SkipSilent: true, SilenceThreshold: -60}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v when the context is canceled, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,112 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// processWaitDelay is the time a canceled process has to exit after being interrupted before it is killed.
+	processWaitDelay = 10 * time.Second
+	// processOutputLines is the amount of output lines that are kept to be included in errors.
+	processOutputLines = 50
+)
+
+// ProgressFunc is called with the progress in percent (0 to 100) while an audio file is transcribed.
+// It may be called from multiple goroutines at once when files are transcribed in parallel.
+type ProgressFunc func(file AudioFile, percent float64)
+
+// progressRegex matches the progress output of WhisperX ("Progress: 42.50%...")
+// and whisper.cpp ("whisper_print_progress_callback: progress =  42%").
+var progressRegex = regexp.MustCompile(`(?i)progress\s*[:=]\s*(\d+(?:\.\d+)?)\s*%`)
+
+// runProcess runs the command until it exits or the context is done.
+// When the context is done the process is interrupted first so it can clean up its child processes, and killed if it does not exit in time.
+// Stdout and stderr are parsed line by line for progress percentages that are reported to progress if it is not nil.
+// The process inherits the environment together with the additional env variables in the form key=value,
+// which should be used for secrets as they are neither visible in the process list nor in errors.
+// If the command fails the returned error contains the last lines of its output.
+func runProcess(ctx context.Context, file AudioFile, progress ProgressFunc, env []string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = processWaitDelay
+	output := &processOutput{file: file, progress: progress}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return errors.Join(ctxErr, fmt.Errorf("%s was terminated", name))
+		}
+		return errors.Join(err, fmt.Errorf("could not run %s, output: %s", cmd, output.String()))
+	}
+	return nil
+}
+
+// processOutput splits the output of a process into lines, reports the progress percentages it contains
+// and keeps the last processOutputLines lines.
+type processOutput struct {
+	file     AudioFile
+	progress ProgressFunc
+
+	mu      sync.Mutex
+	partial []byte
+	lines   []string
+}
+
+func (o *processOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.partial = append(o.partial, p...)
+	for {
+		// progress bars usually overwrite their line with a carriage return instead of starting a new one
+		i := bytes.IndexAny(o.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(o.partial[:i])
+		o.partial = o.partial[i+1:]
+		if line != "" {
+			o.add(line)
+		}
+	}
+	return len(p), nil
+}
+
+func (o *processOutput) add(line string) {
+	o.lines = append(o.lines, line)
+	if len(o.lines) > processOutputLines {
+		o.lines = o.lines[len(o.lines)-processOutputLines:]
+	}
+	if o.progress == nil {
+		return
+	}
+	if match := progressRegex.FindStringSubmatch(line); match != nil {
+		if percent, err := strconv.ParseFloat(match[1], 64); err == nil {
+			o.progress(o.file, min(percent, 100))
+		}
+	}
+}
+
+func (o *processOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	output := strings.Join(o.lines, "\n")
+	if len(o.partial) > 0 {
+		output += "\n" + string(o.partial)
+	}
+	return output
+}
@@ -0,0 +1,29 @@
+package transcribe
+
+// SpeakerSamples returns one sample line for each speaker in the order of their first appearance.
+// The sample is the longest line of the speaker so it is easy to recognize who is talking.
+func SpeakerSamples(words []Word) []Line {
+	samples := make([]Line, 0)
+	index := make(map[string]int)
+	for _, line := range ToLines(words, LineOptions{}) {
+		i, ok := index[line.Nickname]
+		if !ok {
+			index[line.Nickname] = len(samples)
+			samples = append(samples, line)
+			continue
+		}
+		if len(line.Words) > len(samples[i].Words) {
+			samples[i] = line
+		}
+	}
+	return samples
+}
+
+// RenameSpeakers replaces the Word.Nickname of all words whose nickname is a key in the mapping with the mapped value.
+func RenameSpeakers(words []Word, mapping map[string]string) {
+	for i, word := range words {
+		if name, ok := mapping[word.Nickname]; ok && name != "" {
+			words[i].Nickname = name
+		}
+	}
+}
@@ -1,24 +1,36 @@
 package transcribe
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Word is a singular transcribed word.
 type Word struct {
 	// Nickname of the speaker.
-	Nickname string
+	Nickname string `json:"nickname"`
 	// Text that was spoken including puctuation.
-	Text string
+	Text string `json:"text"`
 	// StartTime relative to the beginning of the recording in second floating-point precision.
-	StartTime float64
+	StartTime float64 `json:"start"`
+	// EndTime relative to the beginning of the recording in second floating-point precision.
+	// Can be 0 if the end is unknown.
+	EndTime float64 `json:"end"`
+	// Score is the confidence of the transcription engine between 0 and 1. Can be 0 if the engine provides no score.
+	Score float64 `json:"score"`
+	// Segment is the 1-based index of the segment (usually a sentence) the transcription engine assigned the word to.
+	// The index is only unique within one audio track and 0 if the engine provides no segments.
+	Segment int `json:"segment"`
+	// Language of the audio track the word was transcribed from as ISO 639-1 code, e.g. en. Can be empty if unknown.
+	Language string `json:"language,omitempty"`
 }
 
 func (w *Word) String() string {
@@ -27,12 +39,62 @@ func (w *Word) String() string {
 
 // Line is a line of spoken text by a singular speaker.
 type Line struct {
-	Nickname string
-	Words    []Word
+	Nickname string `json:"nickname"`
+	Words    []Word `json:"words"`
+	// Interrupts is the nickname of the speaker that was still talking when this line started. See LineOptions.Annotate.
+	Interrupts string `json:"interrupts,omitempty"`
+	// Interjection is true if this is a short remark while another speaker was talking. See LineOptions.Annotate.
+	Interjection bool `json:"interjection,omitempty"`
 }
 
 func (l *Line) String() string {
-	return fmt.Sprintf("%s: %s", l.Nickname, l.WordsString())
+	return fmt.Sprintf("%s: %s", l.Nickname, l.Text())
+}
+
+// Text returns the Annotation followed by all words.
+func (l *Line) Text() string {
+	if annotation := l.Annotation(); annotation != "" {
+		return annotation + " " + l.WordsString()
+	}
+	return l.WordsString()
+}
+
+// Annotation returns a marker like [interrupts Darell] or [interjection] if the line overlaps the line of another speaker.
+func (l *Line) Annotation() string {
+	switch {
+	case l.Interrupts != "":
+		return "[interrupts " + l.Interrupts + "]"
+	case l.Interjection:
+		return "[interjection]"
+	default:
+		return ""
+	}
+}
+
+// Start of the line in seconds, which is the StartTime of the first word.
+func (l *Line) Start() float64 {
+	if len(l.Words) == 0 {
+		return 0
+	}
+	return l.Words[0].StartTime
+}
+
+// End of the line in seconds, which is the latest EndTime of all words.
+// If no word has an EndTime the StartTime of the last word is used instead.
+func (l *Line) End() float64 {
+	if len(l.Words) == 0 {
+		return 0
+	}
+	end := l.Words[len(l.Words)-1].StartTime
+	for _, word := range l.Words {
+		end = max(end, word.EndTime)
+	}
+	return end
+}
+
+// Duration of the line in seconds.
+func (l *Line) Duration() float64 {
+	return l.End() - l.Start()
 }
 
 // WordsString returns all words joined by a space.
@@ -44,52 +106,204 @@ func (l *Line) WordsString() string {
 	return strings.Join(wordStrings, " ")
 }
 
-type audioFile struct {
+// AudioFile is a single audio track of one speaker.
+type AudioFile struct {
+	// Nickname of the speaker.
 	Nickname string
+	// Filename is the path to the audio file.
 	Filename string
+	// Offset in seconds at which the recording of the file started relative to the beginning of the session.
+	// The Transcriber ignores the offset, it is added to the Word.StartTime afterwards.
+	Offset float64
+	// Language that is spoken in the file or LanguageAuto. If empty the default language of the Transcriber is used.
+	Language string
+}
+
+// LanguageAuto lets the transcription engine detect the spoken language.
+const LanguageAuto = "auto"
+
+// language returns the Language of the file or the fallback if it has none.
+func (f AudioFile) language(fallback string) string {
+	if f.Language != "" {
+		return f.Language
+	}
+	return fallback
+}
+
+// setLanguage sets the Word.Language of all words and returns them.
+func setLanguage(words []Word, language string) []Word {
+	for i := range words {
+		words[i].Language = language
+	}
+	return words
+}
+
+// DominantLanguage returns the Word.Language of most words of the lines or an empty string if no language is known.
+func DominantLanguage(lines []Line) string {
+	counts := make(map[string]int)
+	for _, line := range lines {
+		for _, word := range line.Words {
+			if word.Language != "" {
+				counts[word.Language]++
+			}
+		}
+	}
+	dominant := ""
+	for language, count := range counts {
+		if count > counts[dominant] || (count == counts[dominant] && language < dominant) {
+			dominant = language
+		}
+	}
+	return dominant
+}
+
+// Transcriber converts the speech in an audio file to text.
+type Transcriber interface {
+	// Transcribe the audio file and return all spoken words in order.
+	// The Word.Nickname will be set to the AudioFile.Nickname unless the engine identifies the speakers itself.
+	// The transcription is aborted with an error when the context is done.
+	Transcribe(ctx context.Context, file AudioFile) ([]Word, error)
+}
+
+// Options to use when transcribing a directory of audio files.
+type Options struct {
+	// FileTypes are the file extensions (without the dot) that should be considered when looking up audio tracks.
+	FileTypes []string
+	// Concurrency is the maximum amount of audio tracks that are transcribed in parallel. Values below 1 are treated as 1.
+	Concurrency int
+	// Nicknames maps the file stem of audio tracks to the nickname of their speaker.
+	// Tracks that are not contained will use their file stem as nickname.
+	Nicknames map[string]string
+	// Filter selects the tracks that are transcribed. If nil all tracks are transcribed.
+	Filter *TrackFilter
+	// Languages maps the file stem or nickname of audio tracks to their spoken language or LanguageAuto.
+	// Tracks that are not contained use the default language of the Transcriber.
+	Languages map[string]string
+	// Offsets maps the file stem or nickname of audio tracks to the offset in seconds at which their recording started.
+	// Offset sidecar files (see OffsetFileSuffix) take precedence over this map.
+	Offsets map[string]float64
+	// DetectOffsets can be true to detect the offsets of all tracks without a configured offset. See DetectOffsets.
+	DetectOffsets bool
+	// DetectWindow is the length of the beginning of each track that is used to detect offsets.
+	DetectWindow time.Duration
+	// Timeout is the maximum duration of the transcription of a single audio track. 0 means no timeout.
+	Timeout time.Duration
+	// SkipSilent can be true to skip all tracks that are not louder than the SilenceThreshold. See ProbeAudio.
+	SkipSilent bool
+	// SilenceThreshold is the RMS level in dBFS that a track must exceed to not be silent.
+	SilenceThreshold float64
+	// RealtimeFactor is how many times faster than realtime the Transcriber is expected to be.
+	// It is used to estimate the runtime of the transcription up front. 0 disables the estimate.
+	RealtimeFactor float64
 }
 
-// AsWords will transcribe all audio files in the given directory that match the fileExtensions.
+// AsWords will transcribe all audio files in the given directory that match the Options.FileTypes using the Transcriber.
 //
-// The language and model will just be passed as-is to WhisperX.
-func AsWords(dir, language, model string, fileExtensions []string) ([]Word, error) {
+// Up to Options.Concurrency files are transcribed in parallel. A failing track will not abort the transcription of the other tracks.
+// Instead all words of the successful tracks are returned together with the joined errors of all failed tracks.
+// When the context is done the running transcriptions are aborted and no further tracks are started.
+func AsWords(ctx context.Context, t Transcriber, dir string, opts Options) ([]Word, error) {
+	words, _, err := transcribeDir(ctx, t, dir, opts, false)
+	return words, err
+}
+
+// transcribeDir transcribes the audio files in dir like AsWords. If probe is true all tracks are probed even if the Options
+// do not require it. Returns the length of the recording in seconds, which is the end of its longest track.
+func transcribeDir(ctx context.Context, t Transcriber, dir string, opts Options, probe bool) ([]Word, float64, error) {
 	files, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, fmt.Errorf("could not open directory %q: %w", dir, err)
+		return nil, 0, fmt.Errorf("could not open directory %q: %w", dir, err)
 	}
-	requests := make([]audioFile, 0)
+	requests := make([]AudioFile, 0)
 	for _, file := range files {
 		// Ignore unwanted files by extension
-		ext := filepath.Ext(file.Name())
-		if !slices.ContainsFunc(fileExtensions, func(desiredExt string) bool {
-			return ext == "."+desiredExt
-		}) {
+		if file.IsDir() || !isAudioFile(file.Name(), opts.FileTypes) {
 			continue
 		}
-		requests = append(requests, audioFile{
-			Nickname: strings.TrimSuffix(filepath.Base(file.Name()), ext),
+		nickname := fileStem(file.Name())
+		if mapped, ok := opts.Nicknames[nickname]; ok && mapped != "" {
+			nickname = mapped
+		}
+		audioFile := AudioFile{
+			Nickname: nickname,
 			Filename: filepath.Join(dir, file.Name()),
-		})
+		}
+		if opts.Filter != nil && !opts.Filter.Matches(audioFile) {
+			slog.Info("skipping filtered audio track", "file", audioFile.Filename, "nickname", audioFile.Nickname)
+			continue
+		}
+		requests = append(requests, audioFile)
+	}
+	durations := make([]time.Duration, len(requests))
+	if probe || opts.SkipSilent || opts.RealtimeFactor > 0 {
+		if requests, durations, err = probeTracks(ctx, requests, opts); err != nil {
+			return nil, 0, err
+		}
 	}
 
-	allWords := make([]Word, 0)
-	tmpDir, err := os.MkdirTemp("", "summairpg-*")
-	if err != nil {
-		return nil, fmt.Errorf("could not create temporary directory: %w", err)
+	for i, audioFile := range requests {
+		if language, ok := trackSetting(opts.Languages, audioFile); ok {
+			requests[i].Language = language
+		}
+	}
+	if err := applyOffsets(ctx, requests, opts.Offsets, opts.DetectOffsets, opts.DetectWindow); err != nil {
+		return nil, 0, err
 	}
 	for _, audioFile := range requests {
-		words, err := transcribeWhisperx(transcribeRequest{
-			file:     audioFile,
-			outDir:   tmpDir,
-			language: language,
-			model:    model,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("could not transcribe file %q: %w", audioFile.Filename, err)
+		if audioFile.Offset != 0 {
+			slog.Info("audio track has a start offset", "file", audioFile.Filename, "offset", audioFile.Offset)
 		}
+	}
+
+	results := make([][]Word, len(requests))
+	errs := make([]error, len(requests))
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, audioFile := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := ctx.Err(); err != nil {
+				errs[i] = fmt.Errorf("transcription of file %q was not started: %w", audioFile.Filename, err)
+				return
+			}
+			trackCtx := ctx
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				trackCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+			slog.Info("transcribing audio track", "file", audioFile.Filename, "nickname", audioFile.Nickname)
+			words, err := t.Transcribe(trackCtx, audioFile)
+			if err != nil {
+				errs[i] = fmt.Errorf("could not transcribe file %q: %w", audioFile.Filename, err)
+				return
+			}
+			slog.Info("audio track transcribed", "file", audioFile.Filename, "words", len(words))
+			for j := range words {
+				words[j].StartTime += audioFile.Offset
+				if words[j].EndTime != 0 {
+					words[j].EndTime += audioFile.Offset
+				}
+			}
+			results[i] = words
+		}()
+	}
+	wg.Wait()
+
+	// merge in the order of the files so equal timestamps are always sorted the same way
+	allWords := make([]Word, 0)
+	length := 0.0
+	for i, words := range results {
 		allWords = append(allWords, words...)
+		length = max(length, requests[i].Offset+durations[i].Seconds())
+		for _, word := range words {
+			length = max(length, wordEnd(word))
+		}
 	}
-	slices.SortFunc(allWords, func(a, b Word) int {
+	slices.SortStableFunc(allWords, func(a, b Word) int {
 		if a.StartTime < b.StartTime {
 			return -1
 		}
@@ -98,145 +312,145 @@ func AsWords(dir, language, model string, fileExtensions []string) ([]Word, erro
 		}
 		return 0
 	})
-	return allWords, nil
+	return allWords, length, errors.Join(errs...)
 }
 
-type transcribeRequest struct {
-	file     audioFile
-	outDir   string
-	language string
-	model    string
+// trackSetting returns the setting of the file, which is looked up by the file stem first and by the nickname afterwards.
+func trackSetting[T any](settings map[string]T, file AudioFile) (T, bool) {
+	if setting, ok := settings[fileStem(file.Filename)]; ok {
+		return setting, true
+	}
+	setting, ok := settings[file.Nickname]
+	return setting, ok
 }
 
-func transcribeWhisperx(req transcribeRequest) ([]Word, error) {
-	abs, err := filepath.Abs(req.file.Filename)
-	if err != nil {
-		return nil, err
-	}
-	nickname := strings.TrimSuffix(filepath.Base(req.file.Filename), filepath.Ext(req.file.Filename))
-	cmd := exec.Command("whisperx",
-		"--model", req.model, "--align_model", "WAV2VEC2_ASR_LARGE_LV60K_960H",
-		"--batch_size", "4", "--task", "transcribe", "--output_dir", req.outDir, "--output_format", "json", "--language", req.language, abs)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, errors.Join(err, fmt.Errorf("could not run %s, output: %s", cmd, out))
-	}
-	outFile := filepath.Join(req.outDir, nickname+".json")
-	f, err := os.Open(outFile)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	var res WhisperxResult
-	if err := json.NewDecoder(f).Decode(&res); err != nil {
-		return nil, err
-	}
-	words := make([]Word, len(res.WordSegments))
-	lastStart := float64(0)
-	for i, word := range res.WordSegments {
-		w := Word{
-			Nickname: nickname,
-			Text:     word.Word,
-		}
-		if word.Start != 0 {
-			w.StartTime = word.Start
-			lastStart = word.Start
-		} else {
-			w.StartTime = lastStart
-		}
-		words[i] = w
-	}
-	return words, nil
-}
-
-type WhisperxResult struct {
-	Segments []struct {
-		Start float64 `json:"start"`
-		End   float64 `json:"end"`
-		Text  string  `json:"text"`
-		Words []struct {
-			Word  string  `json:"word"`
-			Start float64 `json:"start"`
-			End   float64 `json:"end"`
-			Score float64 `json:"score"`
-		} `json:"words"`
-	} `json:"segments"`
-	WordSegments []struct {
-		Word  string  `json:"word"`
-		Start float64 `json:"start"`
-		End   float64 `json:"end"`
-		Score float64 `json:"score"`
-	} `json:"word_segments"`
+// fileStem returns the base name of the file without its extension.
+func fileStem(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
+// The modes to split lines of one speaker.
+const (
+	// LineModeGap only starts a new line of the same speaker after a pause of LineOptions.Gap.
+	LineModeGap = "gap"
+	// LineModeSentence also starts a new line at the end of every segment of the transcription engine.
+	// If the engine provides no segments a new line is started after every sentence instead.
+	LineModeSentence = "sentence"
+)
+
+// LineModes are all supported values of LineOptions.Mode.
+var LineModes = []string{LineModeGap, LineModeSentence}
+
+const (
+	// defaultLineGap is used if LineOptions.Gap is not set.
+	defaultLineGap = 5 * time.Second
+	// defaultTakeoverPause is used if LineOptions.TakeoverPause is not set.
+	defaultTakeoverPause = time.Second
+)
+
+// LineOptions configure how words are split into lines.
+type LineOptions struct {
+	// Mode is one of LineModes. Empty is treated as LineModeGap.
+	Mode string
+	// Gap is the minimum time between the starts of two consecutive words of the same speaker that starts a new line. 0 uses 5 seconds.
+	Gap time.Duration
+	// MaxWords is the maximum amount of words of a line. Longer lines are split after the last sentence that fits,
+	// or after MaxWords words if there is none. 0 means no maximum.
+	MaxWords int
+	// MergeOverlaps can be true to keep the line of a speaker contiguous when other speakers talk at the same time.
+	// The words of the other speakers that overlap the line follow in their own lines afterwards.
+	MergeOverlaps bool
+	// TakeoverPause is the minimum pause of the current speaker in which another speaker must talk to start a new line.
+	// Words of other speakers within shorter pauses are crosstalk that follows the line. Only used if MergeOverlaps is true. 0 uses 1 second.
+	TakeoverPause time.Duration
+	// Annotate can be true to set Line.Interrupts and Line.Interjection for lines that overlap the line of another speaker.
+	// Only used if MergeOverlaps is true.
+	Annotate bool
+	// MaxInterjectionWords is the maximum amount of words of an overlapping line to be an interjection instead of an interruption.
+	MaxInterjectionWords int
 }
 
 // ToLines converts all of the given words to lines of text.
-// A line of text will always be spoken by one speaker, so if speakers switch
-// there will be a new line. There will also be a new line if no speaker is speaking for more than 5 seconds.
-func ToLines(words []Word) []Line {
+// A line of text will always be spoken by one speaker, so if speakers switch there will be a new line.
+// There will also be a new line if the speaker pauses for longer than LineOptions.Gap and, depending on the LineOptions.Mode,
+// at the end of segments or sentences.
+func ToLines(words []Word, opts LineOptions) []Line {
 	if len(words) == 0 {
 		return nil
 	}
-	lines := make([]Line, 0)
-	continousWords := make([]Word, 1)
-	lastWord := words[0]
-	continousWords[0] = lastWord
-	for i, currentWord := range words {
-		if i == 0 {
-			continue
+	if opts.MergeOverlaps {
+		lines := mergeOverlaps(words, opts)
+		if opts.Annotate {
+			annotateOverlaps(lines, opts.MaxInterjectionWords)
 		}
-		if lastWord.Nickname == currentWord.Nickname && (currentWord.StartTime-lastWord.StartTime) < 5 {
+		return lines
+	}
+	lines := make([]Line, 0)
+	continousWords := []Word{words[0]}
+	for _, currentWord := range words[1:] {
+		if opts.continues(continousWords, currentWord) {
 			// Word is in streak
 			continousWords = append(continousWords, currentWord)
-			lastWord = currentWord
+			lines, continousWords = opts.limit(lines, continousWords)
 			continue
 		}
 		// current word is not in streak. Form new line
 		lines = append(lines, asLine(continousWords))
-		continousWords = make([]Word, 1)
-		continousWords[0] = currentWord
-		lastWord = currentWord
+		continousWords = []Word{currentWord}
 	}
 	lines = append(lines, asLine(continousWords))
 	return lines
 }
 
-// LinesFromFile can be used to read all transcription lines from an input file.
-// The Word.StartTime will just be arbitrarily increased by 0.2 for each word.
-func LinesFromFile(file string) ([]Line, error) {
-	content, err := os.ReadFile(file)
-	if err != nil {
-		return nil, err
+// continues returns true if the word belongs to the same line as the previous words.
+func (o LineOptions) continues(line []Word, word Word) bool {
+	gap := o.Gap
+	if gap <= 0 {
+		gap = defaultLineGap
 	}
+	last := line[len(line)-1]
+	return last.Nickname == word.Nickname &&
+		word.StartTime-last.StartTime < gap.Seconds() &&
+		!(o.Mode == LineModeSentence && utteranceEnds(last, word))
+}
 
-	readLines := strings.Split(string(content), "\n")
-	readLines = slices.DeleteFunc(readLines, func(line string) bool {
-		return strings.TrimSpace(line) == ""
-	})
+// limit moves the words of the line to lines if they exceed MaxWords and returns the words that remain for the line.
+func (o LineOptions) limit(lines []Line, line []Word) ([]Line, []Word) {
+	if o.MaxWords <= 0 || len(line) <= o.MaxWords {
+		return lines, line
+	}
+	split := lastSentenceEnd(line[:o.MaxWords])
+	return append(lines, asLine(line[:split])), slices.Clone(line[split:])
+}
 
-	lines := make([]Line, len(readLines))
-	currentTimestamp := float64(0)
-	for i, line := range readLines {
-		colonPos := strings.Index(line, ": ")
-		if colonPos <= 0 {
-			return nil, fmt.Errorf("invalid line %d in transcription file, no 'Nickname: ' found", i)
-		}
-		nickname := line[0:colonPos]
-		words := strings.Split(line[colonPos+2:], " ")
-		l := Line{
-			Nickname: nickname,
-			Words:    make([]Word, len(words)),
-		}
-		for j, word := range words {
-			l.Words[j] = Word{
-				Nickname:  nickname,
-				Text:      word,
-				StartTime: currentTimestamp,
-			}
-			currentTimestamp += 0.2
+// wordEnd returns the EndTime of the word or its StartTime if the end is unknown.
+func wordEnd(word Word) float64 {
+	return max(word.EndTime, word.StartTime)
+}
+
+// utteranceEnds returns true if the current word starts a new segment or, if there are no segments, the last word ended a sentence.
+func utteranceEnds(last, current Word) bool {
+	if last.Segment != 0 && current.Segment != 0 {
+		return last.Segment != current.Segment
+	}
+	return endsSentence(last.Text)
+}
+
+// endsSentence returns true if the word ends with a sentence-ending punctuation mark.
+func endsSentence(word string) bool {
+	word = strings.TrimRight(word, `"')]»“”’`)
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "!") || strings.HasSuffix(word, "?") || strings.HasSuffix(word, "…")
+}
+
+// lastSentenceEnd returns the amount of words up to and including the last word that ends a sentence.
+// If no word ends a sentence the amount of all words is returned.
+func lastSentenceEnd(words []Word) int {
+	for i := len(words); i > 0; i-- {
+		if endsSentence(words[i-1].Text) {
+			return i
 		}
-		lines[i] = l
 	}
-	return lines, nil
+	return len(words)
 }
 
 func asLine(words []Word) Line {
@@ -0,0 +1,142 @@
+package transcribe
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestToLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []Word
+		opts  LineOptions
+		want  []string
+	}{
+		{
+			name:  "gap",
+			words: joinWords(spoken("A", 0, 0, "one two three"), spoken("A", 6.5, 0, "four five")),
+			want:  []string{"A: one two three", "A: four five"},
+		},
+		{
+			name:  "gap is measured between the starts of words",
+			words: []Word{{Nickname: "A", Text: "Sooo...", StartTime: 0, EndTime: 3}, {Nickname: "A", Text: "yes", StartTime: 5.5, EndTime: 6}},
+			want:  []string{"A: Sooo...", "A: yes"},
+		},
+		{
+			name:  "custom gap",
+			words: joinWords(spoken("A", 0, 0, "one two"), spoken("A", 3, 0, "three")),
+			opts:  LineOptions{Gap: 2 * time.Second},
+			want:  []string{"A: one two", "A: three"},
+		},
+		{
+			name:  "speaker change",
+			words: joinWords(spoken("A", 0, 0, "Roll initiative."), spoken("B", 1, 0, "Natural 20!"), spoken("A", 2, 0, "Nice.")),
+			want:  []string{"A: Roll initiative.", "B: Natural 20!", "A: Nice."},
+		},
+		{
+			name:  "gap mode ignores sentences",
+			words: spoken("A", 0, 0, "Hello there. How are you?"),
+			want:  []string{"A: Hello there. How are you?"},
+		},
+		{
+			name:  "sentences without segments",
+			words: spoken("A", 0, 0, `Hello there. "Stop!" How are you? Fine`),
+			opts:  LineOptions{Mode: LineModeSentence},
+			want:  []string{"A: Hello there.", `A: "Stop!"`, "A: How are you?", "A: Fine"},
+		},
+		{
+			name:  "segments",
+			words: joinWords(spoken("A", 0, 1, "Mr. Smith arrives"), spoken("A", 1.5, 2, "and then"), spoken("A", 2.5, 3, "we go")),
+			opts:  LineOptions{Mode: LineModeSentence},
+			want:  []string{"A: Mr. Smith arrives", "A: and then", "A: we go"},
+		},
+		{
+			name:  "max words split after the last sentence",
+			words: spoken("A", 0, 0, "One two. Three four five six seven."),
+			opts:  LineOptions{MaxWords: 5},
+			want:  []string{"A: One two.", "A: Three four five six seven."},
+		},
+		{
+			name:  "max words without sentences",
+			words: spoken("A", 0, 0, "a b c d e f g"),
+			opts:  LineOptions{MaxWords: 3},
+			want:  []string{"A: a b c", "A: d e f", "A: g"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := ToLines(tt.words, tt.opts)
+			got := make([]string, len(lines))
+			for i, line := range lines {
+				got[i] = line.String()
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got lines %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndsSentence(t *testing.T) {
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{word: "end.", want: true},
+		{word: "what?!", want: true},
+		{word: `"Stop!"`, want: true},
+		{word: "(really.)", want: true},
+		{word: "wait…", want: true},
+		{word: "„Halt!“", want: true},
+		{word: "done,", want: false},
+		{word: "3.5", want: false},
+		{word: "dragon", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := endsSentence(tt.word); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUtteranceEnds(t *testing.T) {
+	tests := []struct {
+		name          string
+		last, current Word
+		want          bool
+	}{
+		{name: "same segment", last: Word{Text: "Mr.", Segment: 1}, current: Word{Text: "Smith", Segment: 1}, want: false},
+		{name: "next segment", last: Word{Text: "and", Segment: 1}, current: Word{Text: "then", Segment: 2}, want: true},
+		{name: "no segments", last: Word{Text: "there."}, current: Word{Text: "How"}, want: true},
+		{name: "no segments within a sentence", last: Word{Text: "there,"}, current: Word{Text: "how"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := utteranceEnds(tt.last, tt.current); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastSentenceEnd(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "One two. Three four", want: 2},
+		{text: "One. Two! Three", want: 2},
+		{text: "One two three", want: 3},
+		{text: "One two three.", want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := lastSentenceEnd(spoken("A", 0, 0, tt.text)); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
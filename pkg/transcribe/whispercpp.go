@@ -0,0 +1,127 @@
+package transcribe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EngineWhisperCpp is the name of the whisper.cpp engine.
+const EngineWhisperCpp = "whisper.cpp"
+
+// WhisperCpp transcribes audio files using the whisper.cpp CLI. See https://github.com/ggerganov/whisper.cpp
+//
+// Older versions of whisper.cpp only accept 16 kHz WAV files as input.
+type WhisperCpp struct {
+	// Binary is the name or path of the whisper.cpp CLI, e.g. whisper-cli.
+	Binary string
+	// Model is either a path to a ggml model file or the name of a model like large-v3.
+	// Names will be resolved to ModelsDir/ggml-<name>.bin
+	Model string
+	// ModelsDir is the directory that contains the ggml model files.
+	ModelsDir string
+	// Language that is spoken in the audio files or LanguageAuto. Can be overridden per file by AudioFile.Language.
+	Language string
+	// InitialPrompt is passed to the model as context before the first segment, e.g. a list of proper nouns. See GlossaryPrompt.
+	InitialPrompt string
+	// Progress is called with the progress of each audio file if it is not nil.
+	Progress ProgressFunc
+}
+
+// Transcribe the audio file by running whisper.cpp and parsing its JSON output.
+// Each word is transcribed as its own segment, so the timestamps are on a per-word basis.
+// Since whisper.cpp provides no sentence segments and scores in this mode, Word.Segment and Word.Score stay 0.
+// If the context is done whisper.cpp is interrupted.
+func (t *WhisperCpp) Transcribe(ctx context.Context, file AudioFile) ([]Word, error) {
+	abs, err := filepath.Abs(file.Filename)
+	if err != nil {
+		return nil, err
+	}
+	outDir, err := os.MkdirTemp("", "summairpg-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+	outBase := filepath.Join(outDir, fileStem(abs))
+	args := []string{
+		"--model", t.modelPath(), "--language", file.language(t.Language), "--file", abs,
+		"--output-json", "--output-file", outBase, "--max-len", "1", "--split-on-word", "--no-prints",
+	}
+	if t.InitialPrompt != "" {
+		args = append(args, "--prompt", t.InitialPrompt)
+	}
+	if t.Progress != nil {
+		args = append(args, "--print-progress")
+	}
+	if err := runProcess(ctx, file, t.Progress, nil, t.Binary, args...); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(outBase + ".json")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res whisperCppResult
+	if err := json.NewDecoder(f).Decode(&res); err != nil {
+		return nil, err
+	}
+	words := make([]Word, 0, len(res.Transcription))
+	for _, segment := range res.Transcription {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
+		}
+		words = append(words, Word{
+			Nickname:  file.Nickname,
+			Text:      text,
+			StartTime: float64(segment.Offsets.From) / 1000,
+			EndTime:   float64(segment.Offsets.To) / 1000,
+		})
+	}
+	if file.language(t.Language) == LanguageAuto {
+		slog.Info("language of audio track detected", "file", file.Filename, "language", res.Result.Language)
+	}
+	return setLanguage(words, res.Result.Language), nil
+}
+
+// Fingerprint returns the engine name together with the model, language and initial prompt.
+// The binary is not part of the fingerprint so that updates of whisper.cpp will still hit the cache.
+func (t *WhisperCpp) Fingerprint() string {
+	return fingerprint(EngineWhisperCpp, struct {
+		Model         string
+		Language      string
+		InitialPrompt string `json:",omitempty"`
+	}{
+		Model:         filepath.Base(t.modelPath()),
+		Language:      t.Language,
+		InitialPrompt: t.InitialPrompt,
+	})
+}
+
+func (t *WhisperCpp) modelPath() string {
+	if _, err := os.Stat(t.Model); err == nil {
+		return t.Model
+	}
+	return filepath.Join(t.ModelsDir, "ggml-"+t.Model+".bin")
+}
+
+// whisperCppResult is the JSON output of whisper.cpp when using --output-json.
+type whisperCppResult struct {
+	Transcription []struct {
+		Offsets struct {
+			// From is the start of the segment in milliseconds.
+			From int64 `json:"from"`
+			// To is the end of the segment in milliseconds.
+			To int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+	Result struct {
+		// Language that was spoken or detected.
+		Language string `json:"language"`
+	} `json:"result"`
+}
@@ -0,0 +1,221 @@
+package transcribe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// EngineWhisperX is the name of the WhisperX engine.
+const EngineWhisperX = "whisperx"
+
+// DefaultAlignModels are the alignment models used when WhisperX.AlignModel is empty, by language.
+// Languages that are not contained use the default model of WhisperX.
+var DefaultAlignModels = map[string]string{
+	"en": "WAV2VEC2_ASR_LARGE_LV60K_960H",
+	"de": "jonatasgrosman/wav2vec2-large-xlsr-53-german",
+}
+
+// WhisperX transcribes audio files using the whisperx CLI. See https://github.com/m-bain/whisperX
+type WhisperX struct {
+	// Model to use. See https://huggingface.co/models?sort=trending&search=whisper
+	Model string
+	// Language that is spoken in the audio files or LanguageAuto. Can be overridden per file by AudioFile.Language.
+	Language string
+	// Diarize can be set to true to let WhisperX identify the different speakers within one audio file.
+	// The speaker labels (e.g. SPEAKER_00) will then be used as Word.Nickname.
+	Diarize bool
+	// HfToken is the Hugging Face access token required to download the diarization models.
+	// It is passed to WhisperX via the environment variable HF_TOKEN, so it never shows up in the process list or logs.
+	// If empty the HF_TOKEN of the own environment is inherited.
+	HfToken string `json:"-"`
+	// MinSpeakers is the minimum amount of speakers when diarizing. 0 lets WhisperX decide.
+	MinSpeakers int
+	// MaxSpeakers is the maximum amount of speakers when diarizing. 0 lets WhisperX decide.
+	MaxSpeakers int
+	// InitialPrompt is passed to the model as context before the first segment, e.g. a list of proper nouns. See GlossaryPrompt.
+	InitialPrompt string `json:",omitempty"`
+	// AlignModel is the phoneme model used to align the word timestamps. If empty DefaultAlignModels is used.
+	AlignModel string `json:",omitempty"`
+	// BatchSize is the amount of segments that are transcribed in parallel. 0 lets WhisperX decide.
+	BatchSize int `json:"-"`
+	// Device to run the models on, e.g. cuda or cpu. Empty lets WhisperX decide.
+	Device string `json:"-"`
+	// ComputeType of the model, e.g. float16 or int8. Empty lets WhisperX decide.
+	ComputeType string `json:",omitempty"`
+	// VadOnset is the threshold of the voice activity detection to start a speech segment. 0 lets WhisperX decide.
+	VadOnset float64 `json:",omitempty"`
+	// VadOffset is the threshold of the voice activity detection to end a speech segment. 0 lets WhisperX decide.
+	VadOffset float64 `json:",omitempty"`
+	// ExtraArgs are appended to the arguments of whisperx as-is.
+	ExtraArgs []string `json:",omitempty"`
+	// Wrapper is a command with arguments that whisperx is run with, e.g. ["conda", "run", "-n", "whisperx"].
+	Wrapper []string `json:"-"`
+	// Progress is called with the progress of each audio file if it is not nil.
+	Progress ProgressFunc `json:"-"`
+}
+
+// Transcribe the audio file by running whisperx and parsing its JSON output.
+// If the context is done whisperx is interrupted.
+func (t *WhisperX) Transcribe(ctx context.Context, file AudioFile) ([]Word, error) {
+	abs, err := filepath.Abs(file.Filename)
+	if err != nil {
+		return nil, err
+	}
+	outDir, err := os.MkdirTemp("", "summairpg-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(outDir)
+	language := file.language(t.Language)
+	args := []string{
+		"--model", t.Model, "--task", "transcribe", "--output_dir", outDir, "--output_format", "json",
+	}
+	if language != LanguageAuto {
+		args = append(args, "--language", language)
+	}
+	if alignModel := t.alignModel(language); alignModel != "" {
+		args = append(args, "--align_model", alignModel)
+	}
+	if t.BatchSize > 0 {
+		args = append(args, "--batch_size", strconv.Itoa(t.BatchSize))
+	}
+	if t.Device != "" {
+		args = append(args, "--device", t.Device)
+	}
+	if t.ComputeType != "" {
+		args = append(args, "--compute_type", t.ComputeType)
+	}
+	if t.VadOnset > 0 {
+		args = append(args, "--vad_onset", strconv.FormatFloat(t.VadOnset, 'f', -1, 64))
+	}
+	if t.VadOffset > 0 {
+		args = append(args, "--vad_offset", strconv.FormatFloat(t.VadOffset, 'f', -1, 64))
+	}
+	if t.InitialPrompt != "" {
+		args = append(args, "--initial_prompt", t.InitialPrompt)
+	}
+	if t.Diarize {
+		args = append(args, "--diarize")
+		if t.MinSpeakers > 0 {
+			args = append(args, "--min_speakers", strconv.Itoa(t.MinSpeakers))
+		}
+		if t.MaxSpeakers > 0 {
+			args = append(args, "--max_speakers", strconv.Itoa(t.MaxSpeakers))
+		}
+	}
+	if t.Progress != nil {
+		args = append(args, "--print_progress", "True")
+	}
+	args = append(append(args, t.ExtraArgs...), abs)
+	command := append(slices.Clone(t.Wrapper), "whisperx")
+	var env []string
+	if t.Diarize && t.HfToken != "" {
+		env = append(env, "HF_TOKEN="+t.HfToken)
+	}
+	if err := runProcess(ctx, file, t.Progress, env, command[0], append(command[1:], args...)...); err != nil {
+		return nil, err
+	}
+	outFile := filepath.Join(outDir, fileStem(abs)+".json")
+	f, err := os.Open(outFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res WhisperxResult
+	if err := json.NewDecoder(f).Decode(&res); err != nil {
+		return nil, err
+	}
+	if language == LanguageAuto {
+		slog.Info("language of audio track detected", "file", file.Filename, "language", res.Language)
+		language = res.Language
+	}
+	return setLanguage(res.words(file.Nickname, t.Diarize), language), nil
+}
+
+// Fingerprint returns the engine name together with all settings that change the transcription.
+func (t *WhisperX) Fingerprint() string {
+	return fingerprint(EngineWhisperX, t)
+}
+
+// alignModel returns the configured AlignModel or the default for the language.
+func (t *WhisperX) alignModel(language string) string {
+	if t.AlignModel != "" {
+		return t.AlignModel
+	}
+	return DefaultAlignModels[language]
+}
+
+// WhisperxResult is the JSON output of WhisperX.
+type WhisperxResult struct {
+	Segments []struct {
+		Start   float64        `json:"start"`
+		End     float64        `json:"end"`
+		Text    string         `json:"text"`
+		Speaker string         `json:"speaker"`
+		Words   []WhisperxWord `json:"words"`
+	} `json:"segments"`
+	WordSegments []WhisperxWord `json:"word_segments"`
+	// Language that was spoken or detected.
+	Language string `json:"language"`
+}
+
+// WhisperxWord is a single word in the JSON output of WhisperX.
+type WhisperxWord struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Score float64 `json:"score"`
+	// Speaker is only set when diarization was enabled and a speaker could be assigned to the word.
+	Speaker string `json:"speaker"`
+}
+
+// words converts the words of all segments. If diarized is true the speaker labels of the words or their segment
+// are used as nickname. Words without a speaker label always get the given nickname.
+//
+// Words without timestamps (e.g. numbers that could not be aligned) start and end at the end of the previous word.
+// Segments without any aligned words are split into words that are evenly distributed over the segment.
+func (r *WhisperxResult) words(nickname string, diarized bool) []Word {
+	words := make([]Word, 0, len(r.WordSegments))
+	lastEnd := float64(0)
+	for i, segment := range r.Segments {
+		segmentNickname := nickname
+		if diarized && segment.Speaker != "" {
+			segmentNickname = segment.Speaker
+		}
+		if len(segment.Words) == 0 {
+			line := timedLine(segmentNickname, segment.Text, segment.Start, segment.End)
+			for _, w := range line.Words {
+				w.Segment = i + 1
+				words = append(words, w)
+			}
+			lastEnd = max(lastEnd, segment.End)
+			continue
+		}
+		for _, word := range segment.Words {
+			w := Word{
+				Nickname:  segmentNickname,
+				Text:      word.Word,
+				StartTime: word.Start,
+				EndTime:   word.End,
+				Score:     word.Score,
+				Segment:   i + 1,
+			}
+			if diarized && word.Speaker != "" {
+				w.Nickname = word.Speaker
+			}
+			if word.Start == 0 && word.End == 0 {
+				w.StartTime = lastEnd
+				w.EndTime = lastEnd
+			}
+			lastEnd = max(lastEnd, w.EndTime)
+			words = append(words, w)
+		}
+	}
+	return words
+}